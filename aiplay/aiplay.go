@@ -2,6 +2,7 @@ package aiplay
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/statiolake/witness-counting-game/game"
@@ -9,20 +10,44 @@ import (
 
 type AI interface {
 	Init(config game.GameConfig) error
-	Think(knowledge game.Knowledge, agent game.Agent) (*game.ActionMove, error)
+	Think(knowledge game.Knowledge, agent game.Agent) (game.Action, error)
+}
+
+// Squad 全体をまとめて操作する AI。knowledges, agents および戻り値の行動は
+// Squad の中でのエージェント番号 (InSquadID) の順に並ぶ。
+type SquadAI interface {
+	Init(config game.GameConfig) error
+	Think(knowledges []game.Knowledge, agents []game.Agent) ([]game.Action, error)
 }
 
 type AIPlay struct {
 	Game game.Game
-	AIs  []AI
+	// エージェントごとの AI。SquadAI に操作されるエージェントの分は nil
+	AIs []AI
+	// Squad ごとの AI。エージェントごとの AI で操作する Squad の分は nil
+	SquadAIs []SquadAI
+	// AI が 1 回の Think に使える時間。0 なら制限しない。
+	ThinkTimeout time.Duration
+
+	// 時間切れになった後もまだ終わっていない Think の終了を知らせるチャネル。
+	// 終わるまで同じエージェントや Squad の Think は呼ばない。
+	pending map[thinker]chan struct{}
 }
 
-func (config *AIPlayConfig) BuildAIPlay() AIPlay {
+// 設定が正しくなければ (GameConfig.Validate) エラーを返す。
+func (config *AIPlayConfig) BuildAIPlay() (AIPlay, error) {
+	if err := config.GameConfig.Validate(); err != nil {
+		return AIPlay{}, fmt.Errorf("invalid game config: %w", err)
+	}
+
 	game := config.GameConfig.BuildGame()
 	return AIPlay{
-		Game: game,
-		AIs:  config.AIs,
-	}
+		Game:         game,
+		AIs:          config.AIs,
+		SquadAIs:     config.SquadAIs,
+		ThinkTimeout: config.ThinkTimeout,
+		pending:      map[thinker]chan struct{}{},
+	}, nil
 }
 
 func (g *AIPlay) StepAll() (snapshots []game.Game, err error) {
@@ -51,23 +76,166 @@ func (g *AIPlay) Step() error {
 }
 
 func (g *AIPlay) decideActions() (errs error) {
-	for idx := range g.AIs {
-		agent := &g.Game.Agents[idx]
-		ai := g.AIs[idx]
-		action, err := ai.Think(
-			g.Game.GetKnowledgeFor(agent),
-			agent.Clone(),
-		)
+	for squadID := range g.Game.Squads {
+		var err error
+		if squadID < len(g.SquadAIs) && g.SquadAIs[squadID] != nil {
+			err = g.decideSquadActions(squadID)
+		} else {
+			err = g.decideAgentActions(squadID)
+		}
+
 		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return
+}
+
+func (g *AIPlay) decideAgentActions(squadID int) (errs error) {
+	for idx := range g.Game.Agents {
+		agent := &g.Game.Agents[idx]
+		if agent.SquadID != squadID {
+			continue
+		}
+
+		if idx >= len(g.AIs) || g.AIs[idx] == nil {
 			errs = multierror.Append(errs, fmt.Errorf(
-				"agent %s: %w",
+				"agent %s: no AI is assigned",
 				g.Game.DescribeAgent(agent),
-				err,
 			))
-		} else {
-			agent.Action = action
+			continue
+		}
+
+		ai := g.AIs[idx]
+		knowledge := g.Game.GetKnowledgeFor(agent)
+		cloned := agent.Clone()
+		actions, ok, err := g.think(thinker{id: agent.ID}, func() ([]game.Action, error) {
+			action, err := ai.Think(knowledge, cloned)
+			return []game.Action{action}, err
+		})
+
+		// AI の不具合でゲームを止めることはせず、記録したうえでその場にとど
+		// まらせる
+		switch {
+		case !ok:
+			g.Game.ReportAITimeout(agent)
+		case err != nil:
+			g.Game.ReportAIError(agent, err)
+		default:
+			agent.Action = actions[0]
 		}
 	}
 
 	return
 }
+
+func (g *AIPlay) decideSquadActions(squadID int) error {
+	var members []*game.Agent
+	var knowledges []game.Knowledge
+	var agents []game.Agent
+	for idx := range g.Game.Agents {
+		agent := &g.Game.Agents[idx]
+		if agent.SquadID != squadID {
+			continue
+		}
+
+		members = append(members, agent)
+		knowledges = append(knowledges, g.Game.GetKnowledgeFor(agent))
+		agents = append(agents, agent.Clone())
+	}
+
+	squadName := g.Game.Squads[squadID].Name
+	ai := g.SquadAIs[squadID]
+	actions, ok, err := g.think(thinker{squad: true, id: squadID}, func() ([]game.Action, error) {
+		return ai.Think(knowledges, agents)
+	})
+
+	// 行動の数が合わないのも AI の不具合として扱う
+	if ok && err == nil && len(actions) != len(members) {
+		err = fmt.Errorf(
+			"squad %s: %d actions returned for %d agents",
+			squadName, len(actions), len(members),
+		)
+	}
+
+	if !ok || err != nil {
+		for _, agent := range members {
+			if !ok {
+				g.Game.ReportAITimeout(agent)
+			} else {
+				g.Game.ReportAIError(agent, err)
+			}
+		}
+
+		return nil
+	}
+
+	for idx, agent := range members {
+		agent.Action = actions[idx]
+	}
+
+	return nil
+}
+
+// Think を呼ぶ担当。エージェントごとの AI ならエージェントの ID 、SquadAI
+// なら Squad の ID で見分ける。AI の値そのものは比較できるとは限らないので
+// キーには使わない。
+type thinker struct {
+	squad bool
+	id    int
+}
+
+// ThinkTimeout が設定されていればその時間だけ think の結果を待つ。時間内に
+// 返ってこなければ ok は false となる (think 自体は止められないので、結果は
+// 捨てられる)。前のターンに時間切れになった同じ担当の think がまだ終わって
+// いなければ、新たに呼ばずに時間切れとする。
+//
+// 同じ AI を複数の担当で共有している場合、時間切れになった Think が終わる
+// 前に別の担当の Think が呼ばれることがある。
+func (g *AIPlay) think(
+	key thinker,
+	think func() ([]game.Action, error),
+) (actions []game.Action, ok bool, err error) {
+	if g.ThinkTimeout <= 0 {
+		actions, err = think()
+		return actions, true, err
+	}
+
+	if finished, exists := g.pending[key]; exists {
+		select {
+		case <-finished:
+			delete(g.pending, key)
+		default:
+			return nil, false, nil
+		}
+	}
+
+	type result struct {
+		actions []game.Action
+		err     error
+	}
+
+	// 時間切れの後に書き込んでも詰まらないようにバッファを持たせる
+	done := make(chan result, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		actions, err := think()
+		done <- result{actions: actions, err: err}
+	}()
+
+	timer := time.NewTimer(g.ThinkTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.actions, true, res.err
+	case <-timer.C:
+		if g.pending == nil {
+			g.pending = map[thinker]chan struct{}{}
+		}
+		g.pending[key] = finished
+		return nil, false, nil
+	}
+}
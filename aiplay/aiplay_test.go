@@ -1,12 +1,16 @@
 package aiplay
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/statiolake/witness-counting-game/game"
 	"github.com/statiolake/witness-counting-game/geom"
+	"github.com/statiolake/witness-counting-game/mapgen"
 )
 
 type constAI struct {
@@ -20,10 +24,132 @@ func (ai *constAI) Init(config game.GameConfig) error {
 func (ai *constAI) Think(
 	knowledge game.Knowledge,
 	agent game.Agent,
-) (*game.ActionMove, error) {
+) (game.Action, error) {
 	return &game.ActionMove{Dir: ai.Dir}, nil
 }
 
+// 常にエラーを返す AI
+type errorAI struct{}
+
+func (ai *errorAI) Init(config game.GameConfig) error {
+	return nil
+}
+
+func (ai *errorAI) Think(
+	knowledge game.Knowledge,
+	agent game.Agent,
+) (game.Action, error) {
+	return nil, errors.New("broken")
+}
+
+// 行動を返すまでに Delay だけかかる AI
+type slowAI struct {
+	Delay time.Duration
+}
+
+func (ai *slowAI) Init(config game.GameConfig) error {
+	return nil
+}
+
+func (ai *slowAI) Think(
+	knowledge game.Knowledge,
+	agent game.Agent,
+) (game.Action, error) {
+	time.Sleep(ai.Delay)
+	return game.NewActionMove(geom.NewPolarVector(1, 0)), nil
+}
+
+// release が閉じられるまで Think から戻らない AI。同時に呼ばれた数を数える。
+type blockingAI struct {
+	release chan struct{}
+
+	mu         sync.Mutex
+	calls      int
+	running    int
+	maxRunning int
+}
+
+func (ai *blockingAI) Init(config game.GameConfig) error {
+	return nil
+}
+
+func (ai *blockingAI) Think(
+	knowledge game.Knowledge,
+	agent game.Agent,
+) (game.Action, error) {
+	ai.mu.Lock()
+	ai.calls++
+	ai.running++
+	if ai.running > ai.maxRunning {
+		ai.maxRunning = ai.running
+	}
+	ai.mu.Unlock()
+
+	<-ai.release
+
+	ai.mu.Lock()
+	ai.running--
+	ai.mu.Unlock()
+	return game.NewActionMove(geom.NewPolarVector(1, 0)), nil
+}
+
+// 値レシーバで、比較できない値をインターフェースとして持つ AI
+type tableAI struct {
+	table interface{}
+}
+
+func (ai tableAI) Init(config game.GameConfig) error {
+	return nil
+}
+
+func (ai tableAI) Think(
+	knowledge game.Knowledge,
+	agent game.Agent,
+) (game.Action, error) {
+	return game.NewActionMove(geom.NewPolarVector(1, 0)), nil
+}
+
+// フィールドの西半分にいれば身を潜め、そうでなければとどまる AI
+type westHideAI struct {
+	inits int
+}
+
+func (ai *westHideAI) Init(config game.GameConfig) error {
+	ai.inits++
+	return nil
+}
+
+func (ai *westHideAI) Think(
+	knowledge game.Knowledge,
+	agent game.Agent,
+) (game.Action, error) {
+	if agent.Pos.X < 0 {
+		return game.NewActionHide(), nil
+	}
+	return game.NewActionStay(), nil
+}
+
+// Squad のメンバーを互いに異なる方向へ散らばらせる AI
+type spreadSquadAI struct {
+	numActions int
+}
+
+func (ai *spreadSquadAI) Init(config game.GameConfig) error {
+	return nil
+}
+
+func (ai *spreadSquadAI) Think(
+	knowledges []game.Knowledge,
+	agents []game.Agent,
+) ([]game.Action, error) {
+	var actions []game.Action
+	for idx := 0; idx < ai.numActions; idx++ {
+		angle := 2 * math.Pi * float64(idx) / float64(ai.numActions)
+		actions = append(actions, game.NewActionMove(geom.NewPolarVector(1, angle)))
+	}
+	return actions, nil
+}
+
 func TestConstAI(t *testing.T) {
 	t.Run("AIActionApplied", func(t *testing.T) {
 		m := createAIPlay()
@@ -43,6 +169,200 @@ func TestConstAI(t *testing.T) {
 	})
 }
 
+func TestSquadAI(t *testing.T) {
+	t.Run("SquadActionsApplied", func(t *testing.T) {
+		m := createSquadAIPlay(&spreadSquadAI{numActions: 2})
+
+		if err := m.Step(); err != nil {
+			t.Fatalf("failed to step: %v", err)
+		}
+
+		// squad-01 は SquadAI によって右と左へ散らばる
+		asserts := []struct {
+			id       int
+			expected geom.Coord
+		}{
+			{0, geom.NewCoord(1, 0)},
+			{1, geom.NewCoord(-1, 0)},
+			{2, geom.NewCoord(1, 0)},
+			{3, geom.NewCoord(1, 0)},
+		}
+
+		for _, assert := range asserts {
+			actual := m.Game.Agents[assert.id].Pos
+			if !eq(actual.X, assert.expected.X) || !eq(actual.Y, assert.expected.Y) {
+				t.Fatalf(
+					"agent %d: expected %v but actual %v",
+					assert.id, assert.expected, actual,
+				)
+			}
+		}
+	})
+
+	t.Run("WrongNumberOfActions", func(t *testing.T) {
+		m := createSquadAIPlay(&spreadSquadAI{numActions: 1})
+
+		// 他の AI の不具合と同じく、記録したうえでゲームは続ける
+		if err := m.Step(); err != nil {
+			t.Fatalf("failed to step: %v", err)
+		}
+
+		events := m.Game.EventsOf(game.EventAIError)
+		if len(events) != 2 || events[0].AgentID != 0 || events[1].AgentID != 1 {
+			t.Fatalf("wrong number of actions is not recorded: %v", events)
+		}
+
+		// squad-01 はその場にとどまり、squad-02 は動く
+		for id, x := range []float64{0, 0, 1, 1} {
+			if actual := m.Game.Agents[id].Pos; !eq(actual.X, x) {
+				t.Fatalf("agent %d: expected x %v but actual %v", id, x, actual)
+			}
+		}
+	})
+}
+
+func TestAIFailures(t *testing.T) {
+	failingAIPlay := func(ai AI, timeout time.Duration) AIPlay {
+		return DefaultAIPlayConfig().
+			WithThinkTimeout(timeout).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(game.NewAgentConfig("agent-01h", game.Hunter), ai).
+					WithAgentAdded(
+						game.NewAgentConfig("agent-01r", game.Runner),
+						&constAI{Dir: geom.NewPolarVector(1, 0)},
+					),
+			).
+			mustBuildAIPlay()
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		m := failingAIPlay(&errorAI{}, 0)
+
+		// AI が失敗してもゲームは続く
+		if err := m.Step(); err != nil {
+			t.Fatalf("failed to step: %v", err)
+		}
+
+		events := m.Game.EventsOf(game.EventAIError)
+		if len(events) != 1 || events[0].AgentID != 0 || events[0].Reason != "broken" {
+			t.Fatalf("AI error is not recorded: %v", events)
+		}
+
+		if !eq(m.Game.Agents[0].Pos.X, 0) || !eq(m.Game.Agents[1].Pos.X, 1) {
+			t.Fatalf(
+				"unexpected positions: %v, %v",
+				m.Game.Agents[0].Pos, m.Game.Agents[1].Pos,
+			)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		m := failingAIPlay(&slowAI{Delay: time.Second}, 10*time.Millisecond)
+
+		if err := m.Step(); err != nil {
+			t.Fatalf("failed to step: %v", err)
+		}
+
+		events := m.Game.EventsOf(game.EventAITimeout)
+		if len(events) != 1 || events[0].AgentID != 0 {
+			t.Fatalf("AI timeout is not recorded: %v", events)
+		}
+
+		if !eq(m.Game.Agents[0].Pos.X, 0) {
+			t.Fatalf("timed out action applied: %v", m.Game.Agents[0].Pos)
+		}
+	})
+
+	t.Run("StillThinking", func(t *testing.T) {
+		ai := &blockingAI{release: make(chan struct{})}
+		m := failingAIPlay(ai, 10*time.Millisecond)
+
+		// 前のターンの Think が終わっていなければ、呼ばずに時間切れとする
+		for turn := 0; turn < 2; turn++ {
+			if err := m.Step(); err != nil {
+				t.Fatalf("failed to step: %v", err)
+			}
+
+			events := m.Game.EventsOf(game.EventAITimeout)
+			if len(events) != 1 || events[0].AgentID != 0 {
+				t.Fatalf("turn %d: AI timeout is not recorded: %v", turn, events)
+			}
+		}
+
+		ai.mu.Lock()
+		calls := ai.calls
+		ai.mu.Unlock()
+		if calls != 1 {
+			t.Fatalf("Think called %d times while still running", calls)
+		}
+
+		// 終われば再び呼ばれる
+		close(ai.release)
+		for turn := 0; m.Game.Agents[0].Pos.X == 0; turn++ {
+			if turn >= 50 {
+				t.Fatalf("AI is not called again after finishing")
+			}
+
+			time.Sleep(time.Millisecond)
+			if err := m.Step(); err != nil {
+				t.Fatalf("failed to step: %v", err)
+			}
+		}
+
+		ai.mu.Lock()
+		defer ai.mu.Unlock()
+		if ai.calls != 2 || ai.maxRunning != 1 {
+			t.Fatalf("unexpected calls: %d calls, %d at once", ai.calls, ai.maxRunning)
+		}
+	})
+
+	t.Run("UncomparableAI", func(t *testing.T) {
+		// AI の値を比較しようとして panic してはいけない
+		for _, timeout := range []time.Duration{0, time.Second} {
+			m := failingAIPlay(tableAI{table: []int{1, 2, 3}}, timeout)
+			for turn := 0; turn < 2; turn++ {
+				if err := m.Step(); err != nil {
+					t.Fatalf("failed to step: %v", err)
+				}
+			}
+
+			if !eq(m.Game.Agents[0].Pos.X, 2) {
+				t.Fatalf("timeout %v: action is not applied: %v", timeout, m.Game.Agents[0].Pos)
+			}
+		}
+	})
+
+	t.Run("InTime", func(t *testing.T) {
+		m := failingAIPlay(&slowAI{Delay: 0}, time.Second)
+
+		if err := m.Step(); err != nil {
+			t.Fatalf("failed to step: %v", err)
+		}
+
+		if len(m.Game.EventsOf(game.EventAITimeout)) != 0 || !eq(m.Game.Agents[0].Pos.X, 1) {
+			t.Fatalf("action in time is not applied")
+		}
+	})
+}
+
+func TestBuildAIPlay(t *testing.T) {
+	t.Run("InvalidConfig", func(t *testing.T) {
+		config := DefaultAIPlayConfig().WithSquadAdded(
+			NewSquadConfig("squad-01").
+				WithAgentAdded(
+					game.NewAgentConfig("agent-01h", game.Hunter).
+						WithSpeed(game.NewSpeedLimit(-1, 1)),
+					&constAI{Dir: geom.NewPolarVector(1, 0)},
+				),
+		)
+
+		if _, err := config.BuildAIPlay(); err == nil {
+			t.Fatalf("invalid config accepted")
+		}
+	})
+}
+
 func TestStepAll(t *testing.T) {
 	t.Run("StepAll", func(t *testing.T) {
 		g := createAIPlay()
@@ -96,6 +416,105 @@ func TestStepAll(t *testing.T) {
 	})
 }
 
+func TestPlayRotations(t *testing.T) {
+	// 西側の領域に出現すると身を潜められるので、見つからずに済む分だけ有利
+	// になる。鏡映対称なマップで両方の領域を一度ずつ使えば、差はなくなる。
+	field, err := mapgen.Generate(mapgen.DefaultConfig().
+		WithDensity(0).
+		WithSymmetry(mapgen.SymmetryMirror).
+		WithSquads("squad-01", "squad-02").
+		WithSeed(3))
+	if err != nil {
+		t.Fatalf("failed to generate field: %v", err)
+	}
+
+	var ais []*westHideAI
+	config := DefaultAIPlayConfig()
+	config.GameConfig.WithFieldConfig(field).WithTime(10)
+	for _, name := range []string{"squad-01", "squad-02"} {
+		hunter, runner := &westHideAI{}, &westHideAI{}
+		ais = append(ais, hunter, runner)
+		config.WithSquadAdded(
+			NewSquadConfig(name).
+				WithAgentAdded(game.NewAgentConfig(name+"h", game.Hunter), hunter).
+				WithAgentAdded(game.NewAgentConfig(name+"r", game.Runner), runner),
+		)
+	}
+
+	result, err := config.PlayRotations()
+	if err != nil {
+		t.Fatalf("PlayRotations() failed: %v", err)
+	}
+
+	if len(result.Games) != 2 {
+		t.Fatalf("%d games played for 2 squads", len(result.Games))
+	}
+
+	// shift 回目は squad-(i+shift) が squad-i の領域に出現するので、西側に
+	// 出現した Squad が勝つ
+	for shift, g := range result.Games {
+		if !g.IsFinished() {
+			t.Fatalf("rotation %d is not finished", shift)
+		}
+
+		for idx := range g.Agents {
+			agent := &g.Agents[idx]
+			zone := field.SpawnZones[(agent.SquadID+2-shift)%2].Rect
+			if !zone.Contains(agent.Pos) {
+				t.Errorf(
+					"rotation %d: agent %s is outside of its zone: %v",
+					shift, g.DescribeAgent(agent), agent.Pos,
+				)
+			}
+		}
+
+		west := 0
+		if g.Agents[0].Pos.X > 0 {
+			west = 1
+		}
+		if g.Result.Winner != west || eq(g.Squads[0].TotalPoint, g.Squads[1].TotalPoint) {
+			t.Fatalf(
+				"rotation %d: spawn gives no advantage: winner %d, points %f and %f",
+				shift, g.Result.Winner, g.Squads[0].TotalPoint, g.Squads[1].TotalPoint,
+			)
+		}
+	}
+
+	if !eq(result.AveragePoints[0], result.AveragePoints[1]) {
+		t.Errorf("averages are not even: %v", result.AveragePoints)
+	}
+
+	for idx := range result.AveragePoints {
+		expected := (result.Games[0].Squads[idx].TotalPoint +
+			result.Games[1].Squads[idx].TotalPoint) / 2
+		if !eq(result.AveragePoints[idx], expected) {
+			t.Errorf(
+				"squad %d: average %f, expected %f",
+				idx, result.AveragePoints[idx], expected,
+			)
+		}
+
+		if result.Wins[idx] != 1 {
+			t.Errorf("squad %d won %d times", idx, result.Wins[idx])
+		}
+	}
+
+	// 試合ごとに Init し直す
+	for idx, ai := range ais {
+		if ai.inits != 2 {
+			t.Errorf("AI %d is initialized %d times", idx, ai.inits)
+		}
+	}
+}
+
+func (config *AIPlayConfig) mustBuildAIPlay() AIPlay {
+	m, err := config.BuildAIPlay()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
 func eq(a, b float64) bool {
 	return math.Abs(a-b) < 1e-8
 }
@@ -121,5 +540,31 @@ func createAIPlay() AIPlay {
 		)
 	}
 
-	return config.BuildAIPlay()
+	return config.mustBuildAIPlay()
+}
+
+// squad-01 は squadAI が、squad-02 はエージェントごとの AI が操作する
+func createSquadAIPlay(squadAI SquadAI) AIPlay {
+	config := DefaultAIPlayConfig()
+
+	config.WithSquadAdded(
+		NewSquadConfig("squad-01").
+			WithSquadAI(squadAI).
+			WithAgentAdded(game.NewAgentConfig("agent-01h", game.Hunter), nil).
+			WithAgentAdded(game.NewAgentConfig("agent-01r", game.Runner), nil),
+	)
+
+	config.WithSquadAdded(
+		NewSquadConfig("squad-02").
+			WithAgentAdded(
+				game.NewAgentConfig("agent-02h", game.Hunter),
+				&constAI{Dir: geom.NewPolarVector(1, 0)},
+			).
+			WithAgentAdded(
+				game.NewAgentConfig("agent-02r", game.Runner),
+				&constAI{Dir: geom.NewPolarVector(1, 0)},
+			),
+	)
+
+	return config.mustBuildAIPlay()
 }
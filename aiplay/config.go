@@ -1,27 +1,44 @@
 package aiplay
 
-import "github.com/statiolake/witness-counting-game/game"
+import (
+	"time"
+
+	"github.com/statiolake/witness-counting-game/game"
+)
 
 type AIPlayConfig struct {
-	GameConfig game.GameConfig
-	AIs        []AI
+	GameConfig   game.GameConfig
+	AIs          []AI
+	SquadAIs     []SquadAI
+	ThinkTimeout time.Duration
 }
 
+// Squad のエージェントは、SquadAI が設定されていればそれがまとめて操作し、
+// そうでなければエージェントごとの AIs がそれぞれ操作する。
 type SquadConfig struct {
-	Name   string
-	Agents []game.AgentConfig
-	AIs    []AI
+	Name    string
+	Agents  []game.AgentConfig
+	AIs     []AI
+	SquadAI SquadAI
 }
 
 func DefaultAIPlayConfig() *AIPlayConfig {
 	return &AIPlayConfig{
-		GameConfig: *game.DefaultGameConfig(),
-		AIs:        []AI{},
+		GameConfig:   *game.DefaultGameConfig(),
+		AIs:          []AI{},
+		SquadAIs:     []SquadAI{},
+		ThinkTimeout: 0,
 	}
 }
 
+func (c *AIPlayConfig) WithThinkTimeout(timeout time.Duration) *AIPlayConfig {
+	c.ThinkTimeout = timeout
+	return c
+}
+
 func (c *AIPlayConfig) WithSquadAdded(squad *SquadConfig) *AIPlayConfig {
 	c.AIs = append(c.AIs, squad.AIs...)
+	c.SquadAIs = append(c.SquadAIs, squad.SquadAI)
 
 	squadConfig := game.NewSquadConfig(squad.Name)
 	for idx := range squad.Agents {
@@ -34,12 +51,19 @@ func (c *AIPlayConfig) WithSquadAdded(squad *SquadConfig) *AIPlayConfig {
 
 func NewSquadConfig(name string) *SquadConfig {
 	return &SquadConfig{
-		Name:   name,
-		Agents: []game.AgentConfig{},
-		AIs:    []AI{},
+		Name:    name,
+		Agents:  []game.AgentConfig{},
+		AIs:     []AI{},
+		SquadAI: nil,
 	}
 }
 
+func (c *SquadConfig) WithSquadAI(ai SquadAI) *SquadConfig {
+	c.SquadAI = ai
+	return c
+}
+
+// SquadAI で操作する場合は ai は nil でよい。
 func (c *SquadConfig) WithAgentAdded(agent *game.AgentConfig, ai AI) *SquadConfig {
 	c.Agents = append(c.Agents, agent.Clone())
 	c.AIs = append(c.AIs, ai)
@@ -0,0 +1,96 @@
+package aiplay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/statiolake/witness-counting-game/game"
+)
+
+// 同じマップで、Squad の出現する領域を入れ替えながら繰り返した試合の結果。
+type RotationResult struct {
+	// 入れ替えごとの試合の最終状態
+	Games []game.Game
+	// Squad ごとの総得点の平均 (GameConfig.Squads の順)
+	AveragePoints []float64
+	// Squad ごとの勝った回数 (GameConfig.Squads の順)
+	Wins []int
+}
+
+// Squad の数だけ試合を繰り返し、各 Squad がそれぞれの Squad の出現する領域
+// (FieldConfig.SpawnZones) を一度ずつ使うようにする。shift 回目の試合では、
+// もともと i 番目の Squad の領域に (i+shift) 番目の Squad が出現する。
+//
+// AI はすべての試合で使い回すので、前の試合で覚えたことを持ち越さないよう
+// 試合ごとに Init し直す。
+func (c *AIPlayConfig) PlayRotations() (*RotationResult, error) {
+	numSquads := len(c.GameConfig.Squads)
+	result := &RotationResult{
+		Games:         []game.Game{},
+		AveragePoints: make([]float64, numSquads),
+		Wins:          make([]int, numSquads),
+	}
+
+	for shift := 0; shift < numSquads; shift++ {
+		config := *c
+		config.GameConfig = c.GameConfig.Clone()
+		config.GameConfig.WithSpawnZonesRotated(shift)
+
+		play, err := config.BuildAIPlay()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := play.initAIs(); err != nil {
+			return nil, fmt.Errorf("rotation %d: %w", shift, err)
+		}
+
+		for !play.Game.IsFinished() {
+			if err := play.Step(); err != nil {
+				return nil, fmt.Errorf("rotation %d: %w", shift, err)
+			}
+		}
+
+		for idx := range play.Game.Squads {
+			result.AveragePoints[idx] += play.Game.Squads[idx].TotalPoint / float64(numSquads)
+		}
+
+		if res := play.Game.Result; res != nil && res.Winner != game.NoSquadID {
+			result.Wins[res.Winner]++
+		}
+
+		result.Games = append(result.Games, play.Game)
+	}
+
+	return result, nil
+}
+
+// すべての AI と SquadAI をゲームの設定で初期化する。
+func (g *AIPlay) initAIs() (errs error) {
+	for idx, ai := range g.AIs {
+		if ai == nil {
+			continue
+		}
+
+		if err := ai.Init(g.Game.Config); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"agent %s: failed to init AI: %w",
+				g.Game.DescribeAgent(&g.Game.Agents[idx]), err,
+			))
+		}
+	}
+
+	for idx, ai := range g.SquadAIs {
+		if ai == nil {
+			continue
+		}
+
+		if err := ai.Init(g.Game.Config); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"squad %s: failed to init AI: %w", g.Game.Squads[idx].Name, err,
+			))
+		}
+	}
+
+	return
+}
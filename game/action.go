@@ -0,0 +1,302 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+type ActionType string
+
+const (
+	ActionTypeMove    ActionType = "move"
+	ActionTypeStay    ActionType = "stay"
+	ActionTypeSprint  ActionType = "sprint"
+	ActionTypeHide    ActionType = "hide"
+	ActionTypeSignal  ActionType = "signal"
+	ActionTypeMessage ActionType = "message"
+)
+
+// エージェントが 1 ターンに取る行動。実体は *ActionMove, *ActionStay,
+// *ActionSprint, *ActionHide, *ActionSignal, *ActionMessage のいずれか。
+//
+// 新しい行動を増やすときは applyOn と newActionOfType にも追加すること。
+type Action interface {
+	Type() ActionType
+	clone() Action
+}
+
+// Dir の方向へ Speed までの速さで移動したのち、向きを Turn ラジアンだけ (反
+// 時計回りを正として) 回転する。
+type ActionMove struct {
+	Dir  geom.PolarVector
+	Turn float64
+}
+
+// 移動せずにその場で向きを Turn ラジアンだけ回転する。
+type ActionStay struct {
+	Turn float64
+}
+
+// ActionMove と同様だが、SprintSpeed までの速さで移動できる。
+type ActionSprint struct {
+	Dir  geom.PolarVector
+	Turn float64
+}
+
+// その場に身を潜める。潜んでいる間は HideRange より遠くからは見えない。
+type ActionHide struct{}
+
+// その場にとどまって合図を出す。合図はこのエージェントが見えている全員に
+// Agent.Signal として伝わる。
+type ActionSignal struct {
+	Payload string
+}
+
+// 同じ Squad の仲間に Payload を送ったうえで Action を行う。Action が nil
+// の場合はその場にとどまる。メッセージは次のターンの Knowledge.Messages に
+// 届く。
+type ActionMessage struct {
+	Payload string
+	Action  Action
+}
+
+func NewActionMove(dir geom.PolarVector) *ActionMove {
+	return &ActionMove{Dir: dir}
+}
+
+func NewActionMoveAndTurn(dir geom.PolarVector, turn float64) *ActionMove {
+	return &ActionMove{Dir: dir, Turn: turn}
+}
+
+func NewActionStay() *ActionStay {
+	return &ActionStay{}
+}
+
+func NewActionTurn(turn float64) *ActionStay {
+	return &ActionStay{Turn: turn}
+}
+
+func NewActionSprint(dir geom.PolarVector) *ActionSprint {
+	return &ActionSprint{Dir: dir}
+}
+
+func NewActionHide() *ActionHide {
+	return &ActionHide{}
+}
+
+func NewActionSignal(payload string) *ActionSignal {
+	return &ActionSignal{Payload: payload}
+}
+
+func NewActionMessage(payload string, action Action) *ActionMessage {
+	return &ActionMessage{Payload: payload, Action: action}
+}
+
+func (a *ActionMove) Type() ActionType {
+	return ActionTypeMove
+}
+
+func (a *ActionStay) Type() ActionType {
+	return ActionTypeStay
+}
+
+func (a *ActionSprint) Type() ActionType {
+	return ActionTypeSprint
+}
+
+func (a *ActionHide) Type() ActionType {
+	return ActionTypeHide
+}
+
+func (a *ActionSignal) Type() ActionType {
+	return ActionTypeSignal
+}
+
+func (a *ActionMessage) Type() ActionType {
+	return ActionTypeMessage
+}
+
+func (a *ActionMove) clone() Action {
+	action := *a
+	return &action
+}
+
+func (a *ActionStay) clone() Action {
+	action := *a
+	return &action
+}
+
+func (a *ActionSprint) clone() Action {
+	action := *a
+	return &action
+}
+
+func (a *ActionHide) clone() Action {
+	action := *a
+	return &action
+}
+
+func (a *ActionSignal) clone() Action {
+	action := *a
+	return &action
+}
+
+func (a *ActionMessage) clone() Action {
+	return &ActionMessage{
+		Payload: a.Payload,
+		Action:  cloneAction(a.Action),
+	}
+}
+
+func cloneAction(action Action) Action {
+	if action == nil {
+		return nil
+	}
+	return action.clone()
+}
+
+// JSON 上ではどの行動なのかがわかるように Type を付けて保存する。
+type actionJSON struct {
+	Type ActionType
+	Body json.RawMessage
+}
+
+func MarshalAction(action Action) ([]byte, error) {
+	if action == nil {
+		return []byte("null"), nil
+	}
+
+	body, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(actionJSON{Type: action.Type(), Body: body})
+}
+
+func UnmarshalAction(data []byte) (Action, error) {
+	var raw *actionJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	if raw == nil {
+		return nil, nil
+	}
+
+	action, err := newActionOfType(raw.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw.Body, action); err != nil {
+		return nil, fmt.Errorf("failed to decode %s action: %w", raw.Type, err)
+	}
+
+	return action, nil
+}
+
+func newActionOfType(t ActionType) (Action, error) {
+	switch t {
+	case ActionTypeMove:
+		return &ActionMove{}, nil
+	case ActionTypeStay:
+		return &ActionStay{}, nil
+	case ActionTypeSprint:
+		return &ActionSprint{}, nil
+	case ActionTypeHide:
+		return &ActionHide{}, nil
+	case ActionTypeSignal:
+		return &ActionSignal{}, nil
+	case ActionTypeMessage:
+		return &ActionMessage{}, nil
+	default:
+		return nil, fmt.Errorf("unknown action type: %q", t)
+	}
+}
+
+// 中に Action を含むので、それも Type 付きで保存する
+func (a *ActionMessage) MarshalJSON() ([]byte, error) {
+	action, err := MarshalAction(a.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		Payload string
+		Action  json.RawMessage
+	}{
+		Payload: a.Payload,
+		Action:  action,
+	})
+}
+
+func (a *ActionMessage) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Payload string
+		Action  json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	a.Payload = raw.Payload
+	a.Action = nil
+	if len(raw.Action) == 0 {
+		return nil
+	}
+
+	action, err := UnmarshalAction(raw.Action)
+	if err != nil {
+		return err
+	}
+	a.Action = action
+
+	return nil
+}
+
+func (a Agent) MarshalJSON() ([]byte, error) {
+	// 別名の型を経由しないと MarshalJSON が再帰的に呼ばれてしまう
+	type agent Agent
+
+	action, err := MarshalAction(a.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		agent
+		Action json.RawMessage
+	}{
+		agent:  agent(a),
+		Action: action,
+	})
+}
+
+func (a *Agent) UnmarshalJSON(data []byte) error {
+	type agent Agent
+
+	var raw struct {
+		*agent
+		Action json.RawMessage
+	}
+	raw.agent = (*agent)(a)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	a.Action = nil
+	if len(raw.Action) == 0 {
+		return nil
+	}
+
+	action, err := UnmarshalAction(raw.Action)
+	if err != nil {
+		return err
+	}
+	a.Action = action
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package game
+
+import "fmt"
+
+// Runner が Range 以内にいる Hunter から Turns ターン続けて見られると捕まる。
+// 捕まった Runner はフィールドから取り除かれ、Respawn が有効なら
+// RespawnDelay ターン後に初期位置 (出現する領域があればその中) へ戻ってく
+// る。
+type CaptureConfig struct {
+	Range        float64
+	Turns        int
+	Respawn      bool
+	RespawnDelay int
+}
+
+func NewCaptureConfig(captureRange float64, turns int) *CaptureConfig {
+	return &CaptureConfig{
+		Range:        captureRange,
+		Turns:        turns,
+		Respawn:      false,
+		RespawnDelay: 0,
+	}
+}
+
+func (c *CaptureConfig) WithRespawn(delay int) *CaptureConfig {
+	c.Respawn = true
+	c.RespawnDelay = delay
+	return c
+}
+
+func (c *CaptureConfig) validate() error {
+	if c.Range < 0 || c.RespawnDelay < 0 {
+		return fmt.Errorf(
+			"negative capture parameter: range %f, respawn delay %d",
+			c.Range, c.RespawnDelay,
+		)
+	}
+
+	if c.Turns < 1 {
+		return fmt.Errorf("capture turns must be positive: %d", c.Turns)
+	}
+
+	return nil
+}
+
+// 移動後の位置で捕獲の判定をし、捕まっている Runner の復帰も進める。
+//
+// Runner に限らず、見られると得点を奪われる Kind (KindRegistry.IsPrey) は
+// すべて捕まえられる。捕まえるのはその Kind から得点する Kind である。
+func (g *Game) processCaptures() {
+	cfg := g.Config.Capture
+	if cfg == nil {
+		return
+	}
+
+	// Infection で役割が変わっても他のエージェントの判定に影響しないよう、
+	// 誰が誰を捕まえようとしているかを先にすべて求めておく
+	capturers := make([][]int, len(g.Agents))
+	for idx := range g.Agents {
+		prey := &g.Agents[idx]
+		if g.Config.Kinds.IsPrey(prey.Kind) && !prey.Captured {
+			capturers[idx] = g.findCapturers(prey, cfg.Range)
+		}
+	}
+
+	for idx := range g.Agents {
+		prey := &g.Agents[idx]
+
+		// 捕まっている間に役割が入れ替わって捕まえられない Kind になってい
+		// ることもあるので、復帰は Kind によらず進める
+		if prey.Captured {
+			// 復帰しないなら待つ必要もない
+			if cfg.Respawn {
+				prey.RespawnIn--
+				g.respawnIfReady(prey)
+			}
+			continue
+		}
+
+		if !g.Config.Kinds.IsPrey(prey.Kind) {
+			continue
+		}
+
+		hunterIDs := capturers[idx]
+		if len(hunterIDs) == 0 {
+			prey.CaptureProgress = 0
+			continue
+		}
+
+		prey.CaptureProgress++
+		if prey.CaptureProgress < cfg.Turns {
+			continue
+		}
+
+		// 捕まえたのは最後のターンに Range 以内から見ていた Hunter
+		g.addEvent(Event{
+			Type:     EventCapture,
+			AgentID:  prey.ID,
+			OtherIDs: hunterIDs,
+			From:     prey.Pos,
+		})
+
+		if g.Config.RoleSwitch != nil && g.Config.RoleSwitch.Infection {
+			// フィールドに残ったまま捕まえた側になる
+			g.infect(prey, hunterIDs)
+			continue
+		}
+
+		prey.CaptureProgress = 0
+		prey.Captured = true
+		prey.RespawnIn = cfg.RespawnDelay
+		g.respawnIfReady(prey)
+	}
+}
+
+// prey を captureRange 以内から見ている、prey から得点する Kind のエージェ
+// ントの ID を ID 順に返す。
+func (g *Game) findCapturers(prey *Agent, captureRange float64) (ids []int) {
+	found := map[int]bool{}
+	for _, rule := range g.Config.Kinds.RulesOn(prey.Kind) {
+		if rule.Point <= 0 {
+			continue
+		}
+
+		watcherKind := rule.Watcher
+		for _, watcher := range prey.FindWatchingAgents(g, &watcherKind, false) {
+			if watcher.Pos.DistanceTo(prey.Pos) <= captureRange {
+				found[watcher.ID] = true
+			}
+		}
+	}
+
+	for idx := range g.Agents {
+		if found[idx] {
+			ids = append(ids, idx)
+		}
+	}
+
+	return
+}
+
+func (g *Game) respawnIfReady(a *Agent) {
+	if !g.Config.Capture.Respawn || a.RespawnIn > 0 {
+		return
+	}
+
+	a.Captured = false
+	a.RespawnIn = 0
+	from := a.Pos
+	a.Pos = g.respawnPosFor(a)
+	g.addEvent(Event{
+		Type:    EventRespawn,
+		AgentID: a.ID,
+		From:    from,
+		To:      a.Pos,
+	})
+}
@@ -0,0 +1,109 @@
+package game
+
+import (
+	"math"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+// 全員が移動し終えたあとで、ターンの間に互いの体 (半径 AgentRadius の円)
+// が重なるような移動を取り消す。移動の途中も見るので、速く動いてすれ違う
+// ことはできない。取り消した結果また重なることがあるので、重なりがなくな
+// るまで繰り返す。どの移動を取り消すかはその時点の位置だけから一斉に決め
+// るので、エージェントを処理する順番には依存しない。
+//
+// ただし、もともと重なっていたものが離れようとする移動 (途中で始めより近
+// づかない移動) は取り消さない。そうしないと同じ位置から始まったエージェ
+// ントが動けなくなる。
+func (g *Game) resolveCollisions(prevPos []geom.Coord, prevStamina []float64) {
+	radius := g.Config.AgentRadius
+	if radius <= 0 {
+		return
+	}
+
+	for {
+		colliders := make([][]int, len(g.Agents))
+		found := false
+		for i := range g.Agents {
+			for j := i + 1; j < len(g.Agents); j++ {
+				a, b := &g.Agents[i], &g.Agents[j]
+				if !a.IsOnField() || !b.IsOnField() {
+					continue
+				}
+
+				dist := closestApproach(prevPos[i], a.Pos, prevPos[j], b.Pos)
+				if dist >= 2*radius || dist >= prevPos[i].DistanceTo(prevPos[j]) {
+					continue
+				}
+
+				// 動いた側の移動を取り消す (両方動いていれば両方)
+				if a.Pos != prevPos[i] {
+					colliders[i] = append(colliders[i], j)
+					found = true
+				}
+				if b.Pos != prevPos[j] {
+					colliders[j] = append(colliders[j], i)
+					found = true
+				}
+			}
+		}
+
+		if !found {
+			return
+		}
+
+		for idx, others := range colliders {
+			if len(others) == 0 {
+				continue
+			}
+
+			agent := &g.Agents[idx]
+			g.addEvent(Event{
+				Type:     EventCollision,
+				AgentID:  agent.ID,
+				OtherIDs: others,
+				From:     agent.Pos,
+				To:       prevPos[idx],
+			})
+			agent.Pos = prevPos[idx]
+			agent.Stamina = prevStamina[idx]
+		}
+	}
+}
+
+// a が fromA から toA へ、b が fromB から toB へ同時にまっすぐ動くとき、
+// その間に最も近づいたときの距離。
+func closestApproach(fromA, toA, fromB, toB geom.Coord) float64 {
+	// b から見た a の相対的な位置は d0 から d0 + v まで動く
+	d0 := fromA.Sub(fromB.Vector)
+	v := toA.Sub(fromA.Vector).Sub(toB.Sub(fromB.Vector))
+
+	t := 0.0
+	if l2 := v.Dot(v); l2 > 0 {
+		t = math.Max(0, math.Min(1, -d0.Dot(v)/l2))
+	}
+
+	return d0.Add(v.MulScalar(t)).Length()
+}
+
+// from と to の間の視線を、他のエージェントの体がさえぎっているか。
+func (g *Game) bodyBlocks(from, to *Agent) bool {
+	radius := g.Config.AgentRadius
+	if !g.Config.BodyBlocksSight || radius <= 0 {
+		return false
+	}
+
+	sight := geom.NewSegment(from.Pos, to.Pos)
+	for idx := range g.Agents {
+		other := &g.Agents[idx]
+		if other.ID == from.ID || other.ID == to.ID || !other.IsOnField() {
+			continue
+		}
+
+		if sight.DistanceTo(other.Pos) < radius {
+			return true
+		}
+	}
+
+	return false
+}
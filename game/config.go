@@ -1,21 +1,107 @@
 package game
 
-import "github.com/statiolake/witness-counting-game/geom"
+import (
+	"fmt"
+	"math"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
 
 type GameConfig struct {
 	Field  FieldConfig
 	Squads []SquadConfig
 	Speed  float64
-	Time   int
+	// ActionSprint で移動するときの最大の速さ
+	SprintSpeed float64
+	// Kind の一覧と、どの Kind がどの Kind から得点するか
+	Kinds KindRegistry
+	// Kind ごとの速さの制限。指定がなければ Speed と SprintSpeed を使う。
+	KindSpeeds map[Kind]SpeedLimit
+	// スタミナの最大値 (初期値でもある)
+	MaxStamina float64
+	// Speed を超えて移動した距離 1 あたりに消費するスタミナ
+	StaminaDrain float64
+	// 移動しなかったターンに回復するスタミナ
+	StaminaRegen float64
+	// 1 ターンで回転できる最大の角度 (ラジアン)
+	TurnRate float64
+	// 壁などに阻まれた移動の扱い
+	Movement MovementMode
+	// エージェントの体の半径。0 より大きければ体が重なるような移動はできない。
+	AgentRadius float64
+	// エージェントの体が他のエージェント同士の視線をさえぎるか
+	BodyBlocksSight bool
+	// ActionHide で身を潜めているエージェントが見える最大の距離
+	HideRange float64
+	// 各 Squad の総得点を Knowledge.Scores で公開するか
+	PublicScores bool
+	// Squad の仲間が見ているものを Knowledge.Sightings で共有するか
+	SharedVision bool
+	// Knowledge に含まれる他の Squad の位置の不確かさ
+	Observation ObservationConfig
+	// 不正な行動を取ったエージェントの扱い
+	InvalidAction InvalidActionConfig
+	// メッセージ 1 通の最大のバイト数。0 なら無制限。
+	MessageMaxLen int
+	// Squad 全体で 1 ターンに送れるメッセージの合計バイト数。0 なら無制限。
+	MessageBandwidth int
+	// メッセージが届く最大の距離。0 なら無制限。
+	MessageRange float64
+	Time         int
+	// Runner を捕まえられるようにする設定。nil なら捕まえられない。
+	Capture *CaptureConfig
+	// 役割を入れ替える規則。nil なら入れ替えない。
+	RoleSwitch *RoleSwitchConfig
+	// 時間切れ以外の終了条件。nil なら時間切れまで続ける。
+	End *EndConditions
+	// 時間とともに安全地帯を縮める設定。nil なら縮めない。
+	Shrink *ShrinkConfig
+	// 乱数の種。同じ種なら同じ結果になる。
+	Seed int64
 }
 
 type FieldConfig struct {
-	Rect  geom.Rect
-	Obsts []ObstructionConfig
+	Rect       geom.Rect
+	Obsts      []ObstructionConfig
+	Areas      []AreaConfig
+	SpawnZones []SpawnZoneConfig
+	// 出現する領域に置くエージェント同士の最低限の距離
+	MinSpawnSeparation float64
 }
 
 type ObstructionConfig struct {
 	Segment geom.Segment
+	// 遮蔽物が移動する経路 (Segment からのずれ) 。空なら動かない。最後の点
+	// の次は最初の点へ戻って繰り返す。
+	Path []geom.Vector
+	// Path のある点から次の点まで移動するのにかかるターン数
+	PathInterval int
+	// ドアのように開閉する場合のスケジュール。nil なら常に閉じている。
+	Door *DoorSchedule
+	// 視線だけでなく移動も遮るか (開いているドアは通り抜けられる)
+	Solid bool
+}
+
+// ClosedTurns ターン閉じたのち OpenTurns ターン開く、を繰り返す。Phase だけ
+// ずらしたところから始まる (負なら逆向きにずらす) 。
+type DoorSchedule struct {
+	ClosedTurns int
+	OpenTurns   int
+	Phase       int
+}
+
+// 茂みや沼地、立ち入り禁止区域のような、多角形で表される領域。
+type AreaConfig struct {
+	Polygon geom.Polygon
+	// 中にいるエージェントが ConcealRange より遠くから見えなくなるか
+	Conceals     bool
+	ConcealRange float64
+	// 中にいるエージェントの速さに掛かる倍率
+	SpeedFactor float64
+	// 中に入ることができないか
+	NoGo bool
 }
 
 type SquadConfig struct {
@@ -27,14 +113,47 @@ type AgentConfig struct {
 	Name    string
 	Kind    Kind
 	InitPos geom.Coord
+	// InitPos が指定されているか。指定されていなければ、当てはまる出現領域
+	// (FieldConfig.SpawnZones) があればその中に置かれる。
+	FixedInitPos bool
+	InitHeading  float64
+	// このエージェントだけの速さの制限。nil なら Kind ごとの制限に従う。
+	Speed *SpeedLimit
+}
+
+type SpeedLimit struct {
+	Speed       float64
+	SprintSpeed float64
 }
 
 func DefaultGameConfig() *GameConfig {
 	return &GameConfig{
-		Field:  *DefaultFieldConfig(),
-		Squads: []SquadConfig{},
-		Speed:  1.0,
-		Time:   100,
+		Field:            *DefaultFieldConfig(),
+		Squads:           []SquadConfig{},
+		Speed:            1.0,
+		SprintSpeed:      2.0,
+		Kinds:            *DefaultKindRegistry(),
+		MaxStamina:       10.0,
+		StaminaDrain:     1.0,
+		StaminaRegen:     1.0,
+		TurnRate:         math.Pi / 4,
+		Movement:         MovementReject,
+		AgentRadius:      0,
+		BodyBlocksSight:  false,
+		HideRange:        5.0,
+		PublicScores:     true,
+		SharedVision:     false,
+		Observation:      *DefaultObservationConfig(),
+		InvalidAction:    *DefaultInvalidActionConfig(),
+		MessageMaxLen:    256,
+		MessageBandwidth: 0,
+		MessageRange:     0,
+		Time:             100,
+		Capture:          nil,
+		RoleSwitch:       nil,
+		End:              nil,
+		Shrink:           nil,
+		Seed:             0,
 	}
 }
 
@@ -48,8 +167,116 @@ func (c *GameConfig) WithSquadAdded(squad *SquadConfig) *GameConfig {
 	return c
 }
 
+// SprintSpeed が speed より遅くなる場合は speed に揃える。SprintSpeed を設
+// 定していなかった呼び出し元が、速さを上げただけで不正な設定にならないよう
+// にするため。
 func (c *GameConfig) WithSpeed(speed float64) *GameConfig {
 	c.Speed = speed
+	if c.SprintSpeed < speed {
+		c.SprintSpeed = speed
+	}
+	return c
+}
+
+func (c *GameConfig) WithSprintSpeed(speed float64) *GameConfig {
+	c.SprintSpeed = speed
+	return c
+}
+
+func (c *GameConfig) WithKinds(kinds *KindRegistry) *GameConfig {
+	c.Kinds = kinds.Clone()
+	return c
+}
+
+func (c *GameConfig) WithKindSpeed(kind Kind, limit SpeedLimit) *GameConfig {
+	if c.KindSpeeds == nil {
+		c.KindSpeeds = map[Kind]SpeedLimit{}
+	}
+	c.KindSpeeds[kind] = limit
+	return c
+}
+
+func (c *GameConfig) WithStamina(max, drain, regen float64) *GameConfig {
+	c.MaxStamina = max
+	c.StaminaDrain = drain
+	c.StaminaRegen = regen
+	return c
+}
+
+func (c *GameConfig) WithHideRange(hideRange float64) *GameConfig {
+	c.HideRange = hideRange
+	return c
+}
+
+func (c *GameConfig) WithPublicScores(public bool) *GameConfig {
+	c.PublicScores = public
+	return c
+}
+
+func (c *GameConfig) WithSharedVision(shared bool) *GameConfig {
+	c.SharedVision = shared
+	return c
+}
+
+func (c *GameConfig) WithMessageLimits(maxLen, bandwidth int, messageRange float64) *GameConfig {
+	c.MessageMaxLen = maxLen
+	c.MessageBandwidth = bandwidth
+	c.MessageRange = messageRange
+	return c
+}
+
+func (c *GameConfig) WithTurnRate(turnRate float64) *GameConfig {
+	c.TurnRate = turnRate
+	return c
+}
+
+func (c *GameConfig) WithMovement(movement MovementMode) *GameConfig {
+	c.Movement = movement
+	return c
+}
+
+func (c *GameConfig) WithAgentRadius(radius float64, blocksSight bool) *GameConfig {
+	c.AgentRadius = radius
+	c.BodyBlocksSight = blocksSight
+	return c
+}
+
+func (c *GameConfig) WithInvalidAction(invalidAction *InvalidActionConfig) *GameConfig {
+	c.InvalidAction = *invalidAction
+	return c
+}
+
+func (c *GameConfig) WithObservation(observation *ObservationConfig) *GameConfig {
+	c.Observation = *observation
+	return c
+}
+
+func (c *GameConfig) WithCapture(capture *CaptureConfig) *GameConfig {
+	cloned := *capture
+	c.Capture = &cloned
+	return c
+}
+
+func (c *GameConfig) WithRoleSwitch(roleSwitch *RoleSwitchConfig) *GameConfig {
+	cloned := *roleSwitch
+	c.RoleSwitch = &cloned
+	return c
+}
+
+func (c *GameConfig) WithEndConditions(end *EndConditions) *GameConfig {
+	cloned := *end
+	c.End = &cloned
+	return c
+}
+
+func (c *GameConfig) WithShrink(shrink *ShrinkConfig) *GameConfig {
+	cloned := *shrink
+	c.Shrink = &cloned
+	return c
+}
+
+func (c *GameConfig) WithSeed(seed int64) *GameConfig {
+	c.Seed = seed
 	return c
 }
 
@@ -62,6 +289,10 @@ func DefaultFieldConfig() *FieldConfig {
 	return &FieldConfig{
 		Rect:  geom.NewRectFromPoints(-50.0, -50.0, 50.0, 50.0),
 		Obsts: []ObstructionConfig{},
+		Areas: []AreaConfig{},
+
+		SpawnZones:         []SpawnZoneConfig{},
+		MinSpawnSeparation: 0,
 	}
 }
 
@@ -71,7 +302,78 @@ func (c *FieldConfig) WithRect(rect geom.Rect) *FieldConfig {
 }
 
 func (c *FieldConfig) WithObstructionAdded(obst ObstructionConfig) *FieldConfig {
-	c.Obsts = append(c.Obsts, obst)
+	c.Obsts = append(c.Obsts, obst.Clone())
+	return c
+}
+
+func NewObstructionConfig(segment geom.Segment) *ObstructionConfig {
+	return &ObstructionConfig{
+		Segment:      segment,
+		Path:         []geom.Vector{},
+		PathInterval: 1,
+		Door:         nil,
+		Solid:        false,
+	}
+}
+
+func (c *ObstructionConfig) WithPath(interval int, offsets ...geom.Vector) *ObstructionConfig {
+	c.Path = append([]geom.Vector{}, offsets...)
+	c.PathInterval = interval
+	return c
+}
+
+func (c *ObstructionConfig) WithDoor(closedTurns, openTurns, phase int) *ObstructionConfig {
+	c.Door = &DoorSchedule{
+		ClosedTurns: closedTurns,
+		OpenTurns:   openTurns,
+		Phase:       phase,
+	}
+	return c
+}
+
+func (c *ObstructionConfig) WithSolid() *ObstructionConfig {
+	c.Solid = true
+	return c
+}
+
+func (c *FieldConfig) WithSpawnZoneAdded(zone *SpawnZoneConfig) *FieldConfig {
+	c.SpawnZones = append(c.SpawnZones, zone.Clone())
+	return c
+}
+
+func (c *FieldConfig) WithMinSpawnSeparation(separation float64) *FieldConfig {
+	c.MinSpawnSeparation = separation
+	return c
+}
+
+func (c *FieldConfig) WithAreaAdded(area *AreaConfig) *FieldConfig {
+	c.Areas = append(c.Areas, area.Clone())
+	return c
+}
+
+func NewAreaConfig(polygon geom.Polygon) *AreaConfig {
+	return &AreaConfig{
+		Polygon:      polygon.Clone(),
+		Conceals:     false,
+		ConcealRange: 0,
+		SpeedFactor:  1.0,
+		NoGo:         false,
+	}
+}
+
+func (c *AreaConfig) WithConcealment(concealRange float64) *AreaConfig {
+	c.Conceals = true
+	c.ConcealRange = concealRange
+	return c
+}
+
+func (c *AreaConfig) WithSpeedFactor(factor float64) *AreaConfig {
+	c.SpeedFactor = factor
+	return c
+}
+
+func (c *AreaConfig) WithNoGo() *AreaConfig {
+	c.NoGo = true
 	return c
 }
 
@@ -87,16 +389,36 @@ func (c *SquadConfig) WithAgentAdded(agent *AgentConfig) *SquadConfig {
 	return c
 }
 
+func NewSpeedLimit(speed, sprintSpeed float64) SpeedLimit {
+	return SpeedLimit{
+		Speed:       speed,
+		SprintSpeed: sprintSpeed,
+	}
+}
+
 func NewAgentConfig(name string, kind Kind) *AgentConfig {
 	return &AgentConfig{
-		Name:    name,
-		Kind:    kind,
-		InitPos: geom.NewCoord(0, 0),
+		Name:         name,
+		Kind:         kind,
+		InitPos:      geom.NewCoord(0, 0),
+		FixedInitPos: false,
+		InitHeading:  0,
 	}
 }
 
 func (c *AgentConfig) WithInitPos(pos geom.Coord) *AgentConfig {
 	c.InitPos = pos
+	c.FixedInitPos = true
+	return c
+}
+
+func (c *AgentConfig) WithSpeed(limit SpeedLimit) *AgentConfig {
+	c.Speed = &limit
+	return c
+}
+
+func (c *AgentConfig) WithInitHeading(heading float64) *AgentConfig {
+	c.InitHeading = heading
 	return c
 }
 
@@ -106,23 +428,136 @@ func (c *GameConfig) Clone() GameConfig {
 		squads = append(squads, c.Squads[idx].Clone())
 	}
 
+	kindSpeeds := make(map[Kind]SpeedLimit, len(c.KindSpeeds))
+	for kind, limit := range c.KindSpeeds {
+		kindSpeeds[kind] = limit
+	}
+
+	var capture *CaptureConfig
+	if c.Capture != nil {
+		cloned := *c.Capture
+		capture = &cloned
+	}
+
+	var roleSwitch *RoleSwitchConfig
+	if c.RoleSwitch != nil {
+		cloned := *c.RoleSwitch
+		roleSwitch = &cloned
+	}
+
+	var end *EndConditions
+	if c.End != nil {
+		cloned := *c.End
+		end = &cloned
+	}
+
+	var shrink *ShrinkConfig
+	if c.Shrink != nil {
+		cloned := *c.Shrink
+		shrink = &cloned
+	}
+
 	return GameConfig{
-		Field:  c.Field.Clone(),
-		Squads: squads,
-		Speed:  c.Speed,
-		Time:   c.Time,
+		Field:            c.Field.Clone(),
+		Squads:           squads,
+		Speed:            c.Speed,
+		SprintSpeed:      c.SprintSpeed,
+		Kinds:            c.Kinds.Clone(),
+		KindSpeeds:       kindSpeeds,
+		MaxStamina:       c.MaxStamina,
+		StaminaDrain:     c.StaminaDrain,
+		StaminaRegen:     c.StaminaRegen,
+		TurnRate:         c.TurnRate,
+		Movement:         c.Movement,
+		AgentRadius:      c.AgentRadius,
+		BodyBlocksSight:  c.BodyBlocksSight,
+		HideRange:        c.HideRange,
+		PublicScores:     c.PublicScores,
+		SharedVision:     c.SharedVision,
+		Observation:      c.Observation,
+		InvalidAction:    c.InvalidAction,
+		MessageMaxLen:    c.MessageMaxLen,
+		MessageBandwidth: c.MessageBandwidth,
+		MessageRange:     c.MessageRange,
+		Time:             c.Time,
+		Capture:          capture,
+		RoleSwitch:       roleSwitch,
+		End:              end,
+		Shrink:           shrink,
+		Seed:             c.Seed,
 	}
 }
 
 func (c *FieldConfig) Clone() FieldConfig {
-	obsts := make([]ObstructionConfig, len(c.Obsts))
-	copy(obsts, c.Obsts)
+	obsts := make([]ObstructionConfig, 0, len(c.Obsts))
+	for idx := range c.Obsts {
+		obsts = append(obsts, c.Obsts[idx].Clone())
+	}
+	areas := make([]AreaConfig, 0, len(c.Areas))
+	for idx := range c.Areas {
+		areas = append(areas, c.Areas[idx].Clone())
+	}
+	spawnZones := make([]SpawnZoneConfig, 0, len(c.SpawnZones))
+	for idx := range c.SpawnZones {
+		spawnZones = append(spawnZones, c.SpawnZones[idx].Clone())
+	}
 	return FieldConfig{
 		Rect:  c.Rect,
 		Obsts: obsts,
+		Areas: areas,
+
+		SpawnZones:         spawnZones,
+		MinSpawnSeparation: c.MinSpawnSeparation,
 	}
 }
 
+func (c *ObstructionConfig) Clone() ObstructionConfig {
+	cloned := *c
+	cloned.Path = append([]geom.Vector{}, c.Path...)
+	if c.Door != nil {
+		door := *c.Door
+		cloned.Door = &door
+	}
+	return cloned
+}
+
+// turn ターン目の遮蔽物の位置と、開いているかどうかを返す。
+func (c *ObstructionConfig) stateAt(turn int) (geom.Segment, bool) {
+	segment := c.Segment
+	if n := len(c.Path); n > 0 {
+		interval := c.PathInterval
+		if interval < 1 {
+			interval = 1
+		}
+
+		leg := (turn / interval) % n
+		frac := float64(turn%interval) / float64(interval)
+		from, to := c.Path[leg], c.Path[(leg+1)%n]
+		offset := from.Add(to.Sub(from).MulScalar(frac))
+		segment = geom.NewSegment(
+			segment.A.Add(offset).AsCoord(),
+			segment.B.Add(offset).AsCoord(),
+		)
+	}
+
+	open := false
+	if c.Door != nil {
+		if cycle := c.Door.ClosedTurns + c.Door.OpenTurns; cycle > 0 {
+			// Phase が負でも周期の中の位置が負にならないようにする
+			pos := ((turn+c.Door.Phase)%cycle + cycle) % cycle
+			open = pos >= c.Door.ClosedTurns
+		}
+	}
+
+	return segment, open
+}
+
+func (c *AreaConfig) Clone() AreaConfig {
+	cloned := *c
+	cloned.Polygon = c.Polygon.Clone()
+	return cloned
+}
+
 func (c *SquadConfig) Clone() SquadConfig {
 	agents := make([]AgentConfig, len(c.Agents))
 	copy(agents, c.Agents)
@@ -133,5 +568,195 @@ func (c *SquadConfig) Clone() SquadConfig {
 }
 
 func (c *AgentConfig) Clone() AgentConfig {
-	return *c
+	cloned := *c
+	if c.Speed != nil {
+		speed := *c.Speed
+		cloned.Speed = &speed
+	}
+	return cloned
+}
+
+// エージェントの速さの制限を、エージェントごとの指定、Kind ごとの指定、全
+// 体の指定の順に探して返す。
+func (c *GameConfig) SpeedLimitFor(a *Agent) SpeedLimit {
+	if a.SquadID < len(c.Squads) && a.InSquadID < len(c.Squads[a.SquadID].Agents) {
+		if speed := c.Squads[a.SquadID].Agents[a.InSquadID].Speed; speed != nil {
+			return *speed
+		}
+	}
+
+	if limit, ok := c.KindSpeeds[a.Kind]; ok {
+		return limit
+	}
+
+	return NewSpeedLimit(c.Speed, c.SprintSpeed)
+}
+
+// 設定値に矛盾がないかを確認する。
+func (c *GameConfig) Validate() (errs error) {
+	if err := NewSpeedLimit(c.Speed, c.SprintSpeed).validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	for kind, limit := range c.KindSpeeds {
+		if err := limit.validate(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("kind %d: %w", kind, err))
+		}
+	}
+
+	for _, err := range c.Kinds.validate() {
+		errs = multierror.Append(errs, err)
+	}
+
+	for _, squad := range c.Squads {
+		for _, agent := range squad.Agents {
+			if _, ok := c.Kinds.Kinds[agent.Kind]; !ok {
+				errs = multierror.Append(errs, fmt.Errorf(
+					"agent %s/%s: unknown kind %d", squad.Name, agent.Name, int(agent.Kind),
+				))
+			}
+
+			if agent.Speed == nil {
+				continue
+			}
+
+			if err := agent.Speed.validate(); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf(
+					"agent %s/%s: %w", squad.Name, agent.Name, err,
+				))
+			}
+		}
+	}
+
+	if c.Movement < MovementReject || MovementSlide < c.Movement {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"unknown movement mode: %d", c.Movement,
+		))
+	}
+
+	if c.AgentRadius < 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"negative agent radius: %f", c.AgentRadius,
+		))
+	}
+
+	if c.TurnRate < 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"negative turn rate: %f", c.TurnRate,
+		))
+	}
+
+	if c.MaxStamina < 0 || c.StaminaDrain < 0 || c.StaminaRegen < 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"negative stamina parameter: max %f, drain %f, regen %f",
+			c.MaxStamina, c.StaminaDrain, c.StaminaRegen,
+		))
+	}
+
+	if c.MessageMaxLen < 0 || c.MessageBandwidth < 0 || c.MessageRange < 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"negative message limit: max length %d, bandwidth %d, range %f",
+			c.MessageMaxLen, c.MessageBandwidth, c.MessageRange,
+		))
+	}
+
+	for idx, obst := range c.Field.Obsts {
+		if obst.PathInterval < 0 ||
+			(obst.Door != nil && (obst.Door.ClosedTurns < 0 || obst.Door.OpenTurns < 0)) {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"obstruction %d: negative schedule", idx,
+			))
+		}
+	}
+
+	for idx, area := range c.Field.Areas {
+		if len(area.Polygon.Vertices) < 3 {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"area %d: polygon has only %d vertices",
+				idx, len(area.Polygon.Vertices),
+			))
+		}
+
+		if area.SpeedFactor < 0 || (area.Conceals && area.ConcealRange < 0) {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"area %d: negative parameter: speed factor %f, conceal range %f",
+				idx, area.SpeedFactor, area.ConcealRange,
+			))
+		}
+	}
+
+	for idx := range c.Field.SpawnZones {
+		if err := c.Field.SpawnZones[idx].validate(c.Field.Rect); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("spawn zone %d: %w", idx, err))
+		}
+	}
+
+	if c.Field.MinSpawnSeparation < 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"negative spawn separation: %f", c.Field.MinSpawnSeparation,
+		))
+	}
+
+	if c.Capture != nil {
+		if err := c.Capture.validate(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if c.RoleSwitch != nil {
+		if err := c.RoleSwitch.validate(c.Capture); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if c.End != nil {
+		if err := c.End.validate(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if c.Shrink != nil {
+		if err := c.Shrink.validate(c.Field.Rect); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if err := c.InvalidAction.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.Observation.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if c.Time < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("negative time: %d", c.Time))
+	}
+
+	// 出現する領域に実際に置けるかは、置いてみないと分からない。他の設定が
+	// 正しくなければゲームを作れないので、その場合は確かめない。
+	if errs == nil && len(c.Field.SpawnZones) > 0 {
+		g := c.BuildGame()
+		if err := g.placeAgents(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return
+}
+
+func (l SpeedLimit) validate() error {
+	// NaN も弾けるように否定の形で比べる
+	if !(l.Speed >= 0) {
+		return fmt.Errorf("invalid speed: %f", l.Speed)
+	}
+
+	if !(l.SprintSpeed >= l.Speed) {
+		return fmt.Errorf(
+			"sprint speed %f is slower than speed %f",
+			l.SprintSpeed, l.Speed,
+		)
+	}
+
+	return nil
 }
@@ -0,0 +1,178 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+type EventType string
+
+const (
+	// 移動がそのまま適用された
+	EventMoveApplied EventType = "move applied"
+	// 速さの制限に引っかかり、短い距離だけ移動した
+	EventMoveClamped EventType = "move clamped"
+	// 他のエージェントとぶつかったため、移動が取り消された (From から To
+	// へ戻された)
+	EventCollision EventType = "collision"
+	// 行動が不正だったため適用されなかった (理由は Reason)
+	EventActionRejected EventType = "action rejected"
+	// 新たに相手が見えるようになった
+	EventSightingGained EventType = "sighting gained"
+	// 相手が見えなくなった
+	EventSightingLost EventType = "sighting lost"
+	// 得点が移動した (場外のペナルティなどの場合 OtherIDs は NoAgentID)
+	EventPointTransfer EventType = "point transfer"
+	// Runner が捕まった
+	EventCapture EventType = "capture"
+	// 捕まった Runner が復帰した
+	EventRespawn EventType = "respawn"
+	// 役割が Kind に変わった (理由は Reason)
+	EventRoleChange EventType = "role change"
+	// AI がエラーを返したため、行動が設定されなかった
+	EventAIError EventType = "ai error"
+	// AI が制限時間内に行動を返さなかった
+	EventAITimeout EventType = "ai timeout"
+)
+
+// 1 ターンの間に起きた出来事。使わないフィールドはゼロ値になる。
+type Event struct {
+	Type EventType
+	// 主体となるエージェント
+	AgentID int
+	// 相手となるエージェント (見えた相手、得点をくれた相手、捕まえた
+	// Hunter など)
+	OtherIDs []int
+	// 移動や復帰の前後の位置
+	From geom.Coord
+	To   geom.Coord
+	// 移動した距離や得点の増減
+	Value float64
+	// 役割が変わった場合の新しい Kind
+	Kind   Kind
+	Reason string
+}
+
+func (e *Event) Clone() Event {
+	cloned := *e
+	cloned.OtherIDs = append([]int{}, e.OtherIDs...)
+	return cloned
+}
+
+// このターンに起きた出来事のうち、指定した種類のものを返す。
+func (g *Game) EventsOf(t EventType) (res []Event) {
+	for idx := range g.Events {
+		if g.Events[idx].Type == t {
+			res = append(res, g.Events[idx])
+		}
+	}
+
+	return
+}
+
+// AI がエラーを返したことを記録する。
+func (g *Game) ReportAIError(agent *Agent, err error) {
+	g.addEvent(Event{
+		Type:    EventAIError,
+		AgentID: agent.ID,
+		Reason:  err.Error(),
+	})
+}
+
+// AI が制限時間内に行動を返さなかったことを記録する。
+func (g *Game) ReportAITimeout(agent *Agent) {
+	g.addEvent(Event{
+		Type:    EventAITimeout,
+		AgentID: agent.ID,
+	})
+}
+
+func (g *Game) addEvent(e Event) {
+	g.Events = append(g.Events, e)
+}
+
+// エージェントごとに、見えている (同じ Squad 以外の) エージェントの ID を
+// ID 順に集める。
+func (g *Game) collectSightings() [][]int {
+	sightings := make([][]int, len(g.Agents))
+	for idx := range g.Agents {
+		for _, other := range g.Agents[idx].FindVisibleAgents(g, nil, false) {
+			sightings[idx] = append(sightings[idx], other.ID)
+		}
+	}
+
+	return sightings
+}
+
+func cloneSightings(sightings [][]int) [][]int {
+	if sightings == nil {
+		return nil
+	}
+
+	cloned := make([][]int, 0, len(sightings))
+	for _, ids := range sightings {
+		cloned = append(cloned, append([]int{}, ids...))
+	}
+
+	return cloned
+}
+
+// ターンの前後で見えている相手を比べ、変化を記録する。
+func (g *Game) recordSightingChanges(before, after [][]int) {
+	for idx := range g.Agents {
+		gained, lost := diffIDs(before[idx], after[idx])
+		for _, id := range gained {
+			g.addEvent(Event{
+				Type:     EventSightingGained,
+				AgentID:  idx,
+				OtherIDs: []int{id},
+			})
+		}
+		for _, id := range lost {
+			g.addEvent(Event{
+				Type:     EventSightingLost,
+				AgentID:  idx,
+				OtherIDs: []int{id},
+			})
+		}
+	}
+}
+
+// ソート済みの before と after を比べ、after にだけあるものと before にだけ
+// あるものを返す。
+func diffIDs(before, after []int) (added, removed []int) {
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case j == len(after) || (i < len(before) && before[i] < after[j]):
+			removed = append(removed, before[i])
+			i++
+		case i == len(before) || after[j] < before[i]:
+			added = append(added, after[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+
+	return
+}
+
+func (p *actionPlan) recordMove(a *Agent, from geom.Coord, requested, applied float64) {
+	e := Event{
+		Type:    EventMoveApplied,
+		AgentID: a.ID,
+		From:    from,
+		To:      a.Pos,
+		Value:   applied,
+	}
+
+	if applied < requested {
+		e.Type = EventMoveClamped
+		e.Reason = fmt.Sprintf("requested %f but limited to %f", requested, applied)
+	}
+
+	p.events = append(p.events, e)
+}
@@ -2,27 +2,35 @@ package game
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
+	"sort"
 
-	"github.com/hashicorp/go-multierror"
 	"github.com/statiolake/witness-counting-game/geom"
 )
 
-type Kind int
-
-const (
-	Hunter Kind = iota
-	Runner
-)
-
 type Game struct {
 	Config        GameConfig
 	Field         Field
 	Squads        []Squad
 	Agents        []Agent
 	TimeRemaining int
+	// 誰も動かなかったターンが続いている数
+	IdleTurns int
+	// 終了したときの結果。終了するまでは nil。
+	Result *Result
+	// 直前のターンに起きた役割の変更
+	RoleChanges []RoleChange
+
+	// ターンごとにリセットされる情報
+
+	// このターンに起きた出来事 (起きた順)
+	Events []Event
+
+	// ターン開始時に各エージェントから見えていた相手 (collectSightings)
+	sightings [][]int
 }
 
-// TODO: 渡す情報は考えるべし
 type Knowledge struct {
 	// フィールド情報
 	Field Field
@@ -30,19 +38,52 @@ type Knowledge struct {
 	NumSquads int
 	// Agent の数
 	NumAgents int
-	// 自分
+	// 残りターン数
+	TimeRemaining int
+	// 自分の Squad の総得点
+	SquadPoint float64
+	// 各 Squad の総得点 (PublicScores が無効なら nil)
+	Scores []float64
+	// 自分 (スタミナなどの状態を含む)
 	Me Agent
-	// 自分を見ている、あるいは自分から見える Agent (自分を含む)
+	// 自分から見える Agent (自分を含む)
 	Watchers []Agent
+	// 自分 (SharedVision が有効なら Squad の仲間全員) から見える Agent
+	Sightings []Sighting
+	// 前のターンに同じ Squad の仲間から届いたメッセージ
+	Messages []Message
+	// 前のターンの得点の変動
+	LastPointGains []PointGain
+	// これまでに見たことのある Agent の最後に見た位置
+	LastSeen []LastSeen
+	// 前のターンに起きた役割の変更 (全員に公開される)
+	RoleChanges []RoleChange
+	// 次に Hunter と Runner が入れ替わるまでのターン数。入れ替わらないなら 0。
+	TurnsUntilSwap int
 }
 
 type Field struct {
-	Rect  geom.Rect
-	Obsts []Obstruction
+	Rect geom.Rect
+	// 安全地帯。縮小が設定されていれば時間とともに縮む。
+	SafeRect geom.Rect
+	Obsts    []Obstruction
+	Areas    []Area
 }
 
 type Obstruction struct {
 	Segment geom.Segment
+	// 開いているドアは視線を遮らない
+	Open bool
+	// 閉じている間は通り抜けられない
+	Solid bool
+}
+
+type Area struct {
+	Polygon      geom.Polygon
+	Conceals     bool
+	ConcealRange float64
+	SpeedFactor  float64
+	NoGo         bool
 }
 
 type Squad struct {
@@ -53,6 +94,7 @@ type Squad struct {
 	// ターンごとにリセットされる情報
 
 	TotalPointGain float64
+	MessageBytes   int // このターンに送ったメッセージの合計バイト数
 }
 
 type Agent struct {
@@ -62,12 +104,59 @@ type Agent struct {
 	Name      string
 	Kind      Kind
 	Pos       geom.Coord
+	Heading   float64 // 向いている方向 (ラジアン, (-π, π])
+	Stamina   float64 // Speed を超えて移動するために必要
 	Point     float64
 
+	// 捕まるまでに続けて見られたターン数
+	CaptureProgress int
+	// 捕まってフィールドから取り除かれているか
+	Captured bool
+	// 捕まっている場合、復帰するまでのターン数
+	RespawnIn int
+
+	// これまでに不正な行動を取った回数
+	Violations int
+	// 罰として行動できないターン数
+	FrozenTurns int
+	// 失格となってフィールドから取り除かれているか
+	Disqualified bool
+
+	// 前のターンの終わりに届いたメッセージ (次のターンまで保持する)
+	Inbox []Message
+	// 各ターンの終わりの状態 (古い順に ObservationConfig.Delay + 1 ターン分
+	// で、最後は現在の状態) 。それぞれの History は空になっている。
+	History []Agent
+	// 前のターンの PointGains
+	LastPointGains []PointGain
+	// これまでに見たことのある Agent を最後に見た位置とターン (AgentID 順)
+	LastSeen []LastSeen
+
 	// ターンごとにリセットされる情報
 
 	PointGains []PointGain
-	Action     *ActionMove
+	Action     Action
+	Hidden     bool   // Hide によって身を潜めているか
+	Signal     string // Signal によって出している合図
+	Outbox     string // このターンに仲間へ送ったメッセージ
+	Penalty    *Penalty
+}
+
+type LastSeen struct {
+	AgentID int
+	Pos     geom.Coord
+	Turn    int
+}
+
+type Sighting struct {
+	Agent Agent
+	// この Agent が見えている観測者の ID
+	ObserverIDs []int
+}
+
+type Message struct {
+	AgentIDSentFrom int
+	Payload         string
 }
 
 // Runner が Hunter にポイントを提供するときは負の Gain として扱う。
@@ -79,24 +168,37 @@ type PointGain struct {
 	// Marshal をカスタムして JSON 出力時だけ整数値に置き換えることはできるか
 	// もしれないが、その場合でも Unmarshal を実装するのは無理そう。PointGain
 	// を Unmarshal するときに []Agent が必要ということになるため。
+	//
+	// エージェント以外 (場外にいることなど) による増減の場合は NoAgentID とな
+	// る。
 	AgentIDGainedFrom int
 	Gain              float64
 }
 
-type ActionMove struct {
-	Dir geom.PolarVector
-}
+const NoAgentID = -1
 
 func (c *GameConfig) BuildGame() Game {
 	obsts := []Obstruction{}
 
-	for _, obst := range c.Field.Obsts {
-		obsts = append(obsts, Obstruction(obst))
+	for idx := range c.Field.Obsts {
+		segment, open := c.Field.Obsts[idx].stateAt(0)
+		obsts = append(obsts, Obstruction{
+			Segment: segment,
+			Open:    open,
+			Solid:   c.Field.Obsts[idx].Solid,
+		})
+	}
+
+	areas := []Area{}
+	for idx := range c.Field.Areas {
+		areas = append(areas, Area(c.Field.Areas[idx].Clone()))
 	}
 
 	field := Field{
-		Rect:  c.Field.Rect,
-		Obsts: obsts,
+		Rect:     c.Field.Rect,
+		SafeRect: c.Field.Rect,
+		Obsts:    obsts,
+		Areas:    areas,
 	}
 
 	squads := []Squad{}
@@ -117,20 +219,36 @@ func (c *GameConfig) BuildGame() Game {
 				Name:       agent.Name,
 				Kind:       agent.Kind,
 				Pos:        agent.InitPos,
+				Heading:    geom.NormalizeAngle(agent.InitHeading),
+				Stamina:    c.MaxStamina,
 				Point:      0,
 				PointGains: []PointGain{},
 				Action:     nil,
+				Inbox:      []Message{},
+				History:    []Agent{},
+
+				LastPointGains: []PointGain{},
+				LastSeen:       []LastSeen{},
 			})
 		}
 	}
 
-	return Game{
+	g := Game{
 		Config:        c.Clone(),
 		Field:         field,
 		Squads:        squads,
 		Agents:        agents,
 		TimeRemaining: c.Time,
+		RoleChanges:   []RoleChange{},
+		Events:        []Event{},
 	}
+	// 置けなかったエージェントがいても、試した中で最もよい位置に置いて始め
+	// る。置けるかどうかは Validate で確かめる。
+	_ = g.placeAgents()
+	g.updateLastSeen()
+	g.recordHistory()
+
+	return g
 }
 
 func (g *Game) Clone() Game {
@@ -141,45 +259,97 @@ func (g *Game) Clone() Game {
 		agents = append(agents, g.Agents[idx].Clone())
 	}
 
+	events := make([]Event, 0, len(g.Events))
+	for idx := range g.Events {
+		events = append(events, g.Events[idx].Clone())
+	}
+
 	return Game{
 		Config:        g.Config.Clone(),
 		Field:         g.Field.Clone(),
 		Squads:        squads,
 		Agents:        agents,
 		TimeRemaining: g.TimeRemaining,
+		IdleTurns:     g.IdleTurns,
+		Result:        g.Result.Clone(),
+		RoleChanges:   append([]RoleChange{}, g.RoleChanges...),
+		Events:        events,
+		sightings:     cloneSightings(g.sightings),
 	}
 }
 
 func (f *Field) Clone() Field {
 	obsts := make([]Obstruction, len(f.Obsts))
 	copy(obsts, f.Obsts)
+	areas := make([]Area, 0, len(f.Areas))
+	for _, area := range f.Areas {
+		area.Polygon = area.Polygon.Clone()
+		areas = append(areas, area)
+	}
 	return Field{
-		Rect:  f.Rect,
-		Obsts: obsts,
+		Rect:     f.Rect,
+		SafeRect: f.SafeRect,
+		Obsts:    obsts,
+		Areas:    areas,
 	}
 }
 
 func (a *Agent) Clone() Agent {
-	// ポインタなので NextAction を丁寧にコピーする必要がある
-	var nextAction *ActionMove
-	if a.Action != nil {
-		action := *a.Action
-		nextAction = &action
+	var penalty *Penalty
+	if a.Penalty != nil {
+		cloned := *a.Penalty
+		penalty = &cloned
 	}
 
 	pointGains := make([]PointGain, len(a.PointGains))
 	copy(pointGains, a.PointGains)
 
+	inbox := make([]Message, len(a.Inbox))
+	copy(inbox, a.Inbox)
+
+	lastPointGains := make([]PointGain, len(a.LastPointGains))
+	copy(lastPointGains, a.LastPointGains)
+
+	lastSeen := make([]LastSeen, len(a.LastSeen))
+	copy(lastSeen, a.LastSeen)
+
+	history := make([]Agent, len(a.History))
+	for idx := range a.History {
+		history[idx] = a.History[idx].Clone()
+	}
+
 	return Agent{
-		ID:         a.ID,
-		InSquadID:  a.InSquadID,
-		SquadID:    a.SquadID,
-		Name:       a.Name,
-		Kind:       a.Kind,
-		Pos:        a.Pos,
-		Point:      a.Point,
+		ID:        a.ID,
+		InSquadID: a.InSquadID,
+		SquadID:   a.SquadID,
+		Name:      a.Name,
+		Kind:      a.Kind,
+		Pos:       a.Pos,
+		Heading:   a.Heading,
+		Stamina:   a.Stamina,
+		Point:     a.Point,
+
+		CaptureProgress: a.CaptureProgress,
+		Captured:        a.Captured,
+		RespawnIn:       a.RespawnIn,
+
+		Violations:   a.Violations,
+		FrozenTurns:  a.FrozenTurns,
+		Disqualified: a.Disqualified,
+
+		Inbox:          inbox,
+		History:        history,
+		LastPointGains: lastPointGains,
+		LastSeen:       lastSeen,
+
 		PointGains: pointGains,
-		Action:     nextAction,
+		// ポインタなので Action を丁寧にコピーする必要がある
+		Action: cloneAction(a.Action),
+		Hidden: a.Hidden,
+		Signal: a.Signal,
+		Outbox: a.Outbox,
+		// ポインタなので Penalty も丁寧にコピーする必要がある
+		Penalty: penalty,
 	}
 }
 
@@ -189,21 +359,176 @@ func (g *Game) GetKnowledgeFor(agent *Agent) Knowledge {
 	numAgents := len(g.Agents)
 	me := agent.Clone()
 	var watchers []Agent
-	for _, agent := range agent.FindWatchingAgents(g, nil, true) {
-		watchers = append(watchers, agent.Clone())
+	for idx := range g.Agents {
+		if view, ok := g.observe(agent, &g.Agents[idx]); ok {
+			watchers = append(watchers, view)
+		}
+	}
+	sightings := g.findSightingsFor(agent)
+
+	var scores []float64
+	if g.Config.PublicScores {
+		for idx := range g.Squads {
+			scores = append(scores, g.Squads[idx].TotalPoint)
+		}
 	}
 
 	return Knowledge{
-		Field:     field,
-		NumSquads: numSquads,
-		NumAgents: numAgents,
-		Me:        me,
-		Watchers:  watchers,
+		Field:          field,
+		NumSquads:      numSquads,
+		NumAgents:      numAgents,
+		TimeRemaining:  g.TimeRemaining,
+		SquadPoint:     g.Squads[agent.SquadID].TotalPoint,
+		Scores:         scores,
+		Me:             me,
+		Watchers:       watchers,
+		Sightings:      sightings,
+		Messages:       me.Inbox,
+		LastPointGains: me.LastPointGains,
+		LastSeen:       me.LastSeen,
+		RoleChanges:    append([]RoleChange{}, g.RoleChanges...),
+		TurnsUntilSwap: g.turnsUntilSwap(),
+	}
+}
+
+// a から見た other の情報を返す。他の Squad のメッセージや記憶は見えてはい
+// けない。
+//
+// 行動は順に決めるので、他の Agent の行動はたとえ仲間のものでも見えてはい
+// けない (先に決めた Agent の行動やメッセージが筒抜けになってしまう) 。
+func (a *Agent) viewOf(other *Agent) Agent {
+	view := other.Clone()
+	if view.ID != a.ID {
+		view.Action = nil
+	}
+
+	if view.SquadID != a.SquadID {
+		view.Outbox = ""
+		view.Inbox = []Message{}
+		view.LastSeen = []LastSeen{}
+		view.History = []Agent{}
+	}
+	return view
+}
+
+// agent が知ることのできる Agent を、誰から見えているかと一緒に返す。
+// SharedVision が有効なら同じ Squad の仲間から見えているものも含む。
+func (g *Game) findSightingsFor(agent *Agent) (res []Sighting) {
+	var observers []*Agent
+	for idx := range g.Agents {
+		other := &g.Agents[idx]
+		if other.ID == agent.ID ||
+			(g.Config.SharedVision && other.SquadID == agent.SquadID) {
+			observers = append(observers, other)
+		}
+	}
+
+	for idx := range g.Agents {
+		target := &g.Agents[idx]
+		var observerIDs []int
+		var view Agent
+		nearest := math.Inf(1)
+		for _, observer := range observers {
+			observed, ok := g.observe(observer, target)
+			if !ok {
+				continue
+			}
+
+			observerIDs = append(observerIDs, observer.ID)
+
+			// 複数から見えている場合は最も近い観測者の観測を使う
+			if dist := observer.Pos.DistanceTo(target.Pos); dist < nearest {
+				nearest = dist
+				view = observed
+			}
+		}
+
+		if len(observerIDs) > 0 {
+			res = append(res, Sighting{
+				Agent:       view,
+				ObserverIDs: observerIDs,
+			})
+		}
+	}
+
+	return
+}
+
+const (
+	randSaltObservation int64 = iota + 1
+	randSaltSpawn
+)
+
+// Seed と現在のターン数、および salts だけから決まる乱数生成器を返す。乱数
+// の状態を Game に持たせないので、Clone や JSON を経由しても同じ乱数列を再
+// 現できる。
+func (g *Game) newRand(salts ...int64) *rand.Rand {
+	h := splitmix64(uint64(g.Config.Seed))
+	h = splitmix64(h ^ uint64(g.Turn()))
+	for _, salt := range salts {
+		h = splitmix64(h ^ uint64(salt))
+	}
+	return rand.New(rand.NewSource(int64(h)))
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// 動く遮蔽物やドアを現在のターンの状態にする。
+func (g *Game) updateObstructions() {
+	turn := g.Turn()
+	for idx := range g.Field.Obsts {
+		obst := &g.Field.Obsts[idx]
+		obst.Segment, obst.Open = g.Config.Field.Obsts[idx].stateAt(turn)
+	}
+}
+
+// 開始してから経過したターン数
+func (g *Game) Turn() int {
+	return g.Config.Time - g.TimeRemaining
+}
+
+// 各エージェントの LastSeen を、現在知ることのできる Agent で更新する。
+func (g *Game) updateLastSeen() {
+	turn := g.Turn()
+	sightings := make([][]Sighting, len(g.Agents))
+	for idx := range g.Agents {
+		sightings[idx] = g.findSightingsFor(&g.Agents[idx])
+	}
+
+	for idx := range g.Agents {
+		g.Agents[idx].rememberSightings(sightings[idx], turn)
+	}
+}
+
+func (a *Agent) rememberSightings(sightings []Sighting, turn int) {
+	for _, sighting := range sightings {
+		seen := LastSeen{
+			AgentID: sighting.Agent.ID,
+			Pos:     sighting.Agent.Pos,
+			Turn:    turn,
+		}
+
+		// AgentID 順を保ったまま挿入または更新する
+		pos := sort.Search(len(a.LastSeen), func(i int) bool {
+			return a.LastSeen[i].AgentID >= seen.AgentID
+		})
+		if pos < len(a.LastSeen) && a.LastSeen[pos].AgentID == seen.AgentID {
+			a.LastSeen[pos] = seen
+		} else {
+			a.LastSeen = append(a.LastSeen, LastSeen{})
+			copy(a.LastSeen[pos+1:], a.LastSeen[pos:])
+			a.LastSeen[pos] = seen
+		}
 	}
 }
 
 func (g *Game) IsFinished() bool {
-	return g.TimeRemaining == 0
+	return g.TimeRemaining == 0 || g.Result != nil
 }
 
 func (g *Game) CommitTurn() error {
@@ -211,13 +536,45 @@ func (g *Game) CommitTurn() error {
 		return fmt.Errorf("attempted to step an finished game")
 	}
 
-	// エラーは無視する (ゲーム中は基本的にエラーがあっても継続してほしい;
-	// エージェントが不正な命令を出した場合の処理は無視)
-	// TODO: 一発退場のような重たい罰にするべき？
-	_ = g.processActions()
+	prevPos := make([]geom.Coord, 0, len(g.Agents))
+	prevStamina := make([]float64, 0, len(g.Agents))
+	for idx := range g.Agents {
+		prevPos = append(prevPos, g.Agents[idx].Pos)
+		prevStamina = append(prevStamina, g.Agents[idx].Stamina)
+	}
+
+	g.RoleChanges = []RoleChange{}
+
+	sightings := g.sightings
+	if sightings == nil {
+		sightings = g.collectSightings()
+	}
+
+	// ゲーム中は基本的にエラーがあっても継続してほしいので、不正な行動は
+	// EventActionRejected として記録し、InvalidAction の設定どおりに罰する
+	g.processActions()
+	g.resolveCollisions(prevPos, prevStamina)
 
 	g.movePoint()
+	g.penalizeOutsiders()
+	g.processCaptures()
+	g.deliverMessages()
 	g.TimeRemaining--
+	g.swapRoles()
+	g.updateObstructions()
+	g.updateSafeRect()
+	g.updateLastSeen()
+	g.recordHistory()
+	g.recordSightingChanges(sightings, g.collectSightings())
+	g.sightings = nil
+
+	moved := false
+	for idx := range g.Agents {
+		if g.Agents[idx].Pos != prevPos[idx] {
+			moved = true
+		}
+	}
+	g.updateResult(moved)
 
 	return nil
 }
@@ -251,28 +608,69 @@ func (a *Agent) FindWatchingAgents(g *Game, targetKind *Kind, includeSquad bool)
 	return
 }
 
-// 同じ Squad のメンバーを含めたい場合は includeSquad を true とする
-func (runner *Agent) FindWatchingHunters(g *Game, includeSquad bool) []*Agent {
-	if runner.Kind != Runner {
-		panic("Find watching hunters called on Runner")
+// FindWatchingAgents とは逆に、a から見えている Agent を探す。Hide などで見
+// え方は非対称になりうるので区別が必要。
+func (a *Agent) FindVisibleAgents(g *Game, targetKind *Kind, includeSquad bool) (res []*Agent) {
+	for idx := range g.Agents {
+		other := &g.Agents[idx]
+		if targetKind != nil && other.Kind != *targetKind {
+			continue
+		}
+
+		if !includeSquad && other.SquadID == a.SquadID {
+			continue
+		}
+
+		if a.IsWatching(other, g) {
+			res = append(res, other)
+		}
 	}
 
-	hunter := Hunter
-	return runner.FindWatchingAgents(g, &hunter, includeSquad)
+	return
 }
 
-// 同じ Squad のメンバーを含めたい場合は includeSquad を true とする
-func (hunter *Agent) FindWatchingRunners(g *Game, includeSquad bool) []*Agent {
-	if hunter.Kind != Hunter {
-		panic("Find watching runners called on Hunter")
-	}
+// a を見ている Hunter を探す。同じ Squad のメンバーを含めたい場合は
+// includeSquad を true とする
+func (a *Agent) FindWatchingHunters(g *Game, includeSquad bool) []*Agent {
+	hunter := Hunter
+	return a.FindWatchingAgents(g, &hunter, includeSquad)
+}
 
+// a を見ている Runner を探す。同じ Squad のメンバーを含めたい場合は
+// includeSquad を true とする
+func (a *Agent) FindWatchingRunners(g *Game, includeSquad bool) []*Agent {
 	runner := Runner
-	return hunter.FindWatchingAgents(g, &runner, includeSquad)
+	return a.FindWatchingAgents(g, &runner, includeSquad)
+}
+
+// 捕まったり失格になったりしてフィールドから取り除かれていないか。
+func (a *Agent) IsOnField() bool {
+	return !a.Captured && !a.Disqualified
 }
 
 func (from *Agent) IsWatching(to *Agent, g *Game) bool {
+	// フィールドにいないエージェントは見ることも見られることもない
+	if !from.IsOnField() || !to.IsOnField() {
+		return false
+	}
+
+	// 身を潜めている相手や茂みの中にいる相手は近くからでないと見えない
+	dist := from.Pos.DistanceTo(to.Pos)
+	if to.Hidden && dist > g.Config.HideRange {
+		return false
+	}
+
+	for _, area := range g.Field.Areas {
+		if area.Conceals && dist > area.ConcealRange && area.Polygon.Contains(to.Pos) {
+			return false
+		}
+	}
+
 	for _, obst := range g.Field.Obsts {
+		if obst.Open {
+			continue
+		}
+
 		ftseg := geom.Segment{
 			A: from.Pos,
 			B: to.Pos,
@@ -285,14 +683,50 @@ func (from *Agent) IsWatching(to *Agent, g *Game) bool {
 		}
 	}
 
-	return true
+	// 間に他のエージェントが立ちふさがっていても見えない
+	return !g.bodyBlocks(from, to)
 }
 
 func (f *Field) MovableTo(agent *Agent, newPos geom.Coord) bool {
-	return (f.Rect.LT.X <= newPos.X &&
-		newPos.X <= f.Rect.RB.X &&
-		f.Rect.LT.Y <= newPos.Y &&
-		newPos.Y <= f.Rect.RB.Y)
+	return f.Rect.Contains(newPos) && f.passable(agent, newPos)
+}
+
+// agent が newPos まで、通り抜けられない遮蔽物や立ち入り禁止区域を越えずに
+// 移動できるか。フィールドの端は考えない。
+func (f *Field) passable(agent *Agent, newPos geom.Coord) bool {
+	// 壁のように通り抜けられない遮蔽物もある
+	path := geom.NewSegment(agent.Pos, newPos)
+	for _, obst := range f.Obsts {
+		if obst.Solid && !obst.Open && obst.Segment.Crosses(path) {
+			return false
+		}
+	}
+
+	// 立ち入り禁止区域には入れないし、通り抜けることもできない。ただしすで
+	// に中にいる場合は出ていくことができる。
+	for _, area := range f.Areas {
+		if !area.NoGo || area.Polygon.Contains(agent.Pos) {
+			continue
+		}
+
+		if area.Polygon.Contains(newPos) || area.Polygon.IntersectsSegment(path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pos での速さに掛かる倍率。複数の領域が重なっている場合は最も遅いものに従
+// う。
+func (f *Field) SpeedFactorAt(pos geom.Coord) float64 {
+	factor := 1.0
+	for _, area := range f.Areas {
+		if area.Polygon.Contains(pos) {
+			factor = math.Min(factor, area.SpeedFactor)
+		}
+	}
+	return factor
 }
 
 func (a *Agent) isRegisteredOn(g *Game) bool {
@@ -301,6 +735,9 @@ func (a *Agent) isRegisteredOn(g *Game) bool {
 
 // エージェントの NextAction やポイント変動情報をリセットする
 func (g *Game) StartTurn() {
+	// Hide などがリセットされる前の、前のターンの終わりの見え方を覚えておく
+	g.sightings = g.collectSightings()
+
 	for idx := range g.Agents {
 		g.Agents[idx].startTurn()
 	}
@@ -308,18 +745,38 @@ func (g *Game) StartTurn() {
 	for idx := range g.Squads {
 		g.Squads[idx].startTurn()
 	}
+
+	g.Events = []Event{}
 }
 
 func (a *Agent) startTurn() {
 	a.Action = nil
+	a.LastPointGains = a.PointGains
 	a.PointGains = []PointGain{}
+	a.Hidden = false
+	a.Signal = ""
+	a.Outbox = ""
+	a.Penalty = nil
 }
 
 func (s *Squad) startTurn() {
 	s.TotalPointGain = 0
+	s.MessageBytes = 0
 }
 
-func (g *Game) processActions() (errs error) {
+// 全員の行動を同時に処理する。どのエージェントの行動も他のエージェントの
+// 処理順に影響されないよう、次の三段階で行う。
+//
+//  1. 計画: 各エージェントの行動の結果を、ターン開始時の状態だけから計算
+//     する (Game は書き換えない)
+//  2. 解決: Squad の帯域を奪い合うメッセージなど、計画同士の競合を処理順に
+//     依存しない方法で解決する
+//  3. 適用: 計画どおりに Game を書き換える
+//
+// 体がぶつかる移動は、全員の移動が終わったあとで resolveCollisions が取り
+// 消す。
+func (g *Game) processActions() {
+	plans := make([]actionPlan, 0, len(g.Agents))
 	for idx := range g.Agents {
 		agent := &g.Agents[idx]
 		if idx != agent.ID {
@@ -329,19 +786,17 @@ func (g *Game) processActions() (errs error) {
 			))
 		}
 
-		// 次の行動が設定されているのであれば適用する。
-		if _, err := agent.applyActionOn(g); err != nil {
-			errs = multierror.Append(errs, fmt.Errorf(
-				"failed to execute a step in agent %s: %w",
-				g.DescribeAgent(agent),
-				err,
-			))
-		}
+		plans = append(plans, agent.planOn(g))
 	}
 
-	return
+	g.resolveMessages(plans)
+
+	for idx := range plans {
+		g.applyPlan(&plans[idx])
+	}
 }
 
+// 一人分の行動だけを処理する。
 func (a *Agent) applyActionOn(g *Game) (bool, error) {
 	if !a.isRegisteredOn(g) {
 		return false, fmt.Errorf(
@@ -350,84 +805,275 @@ func (a *Agent) applyActionOn(g *Game) (bool, error) {
 		)
 	}
 
-	action := a.Action
-	if action == nil {
+	plans := []actionPlan{a.planOn(g)}
+	g.resolveMessages(plans)
+	g.applyPlan(&plans[0])
+
+	return plans[0].ok, plans[0].err
+}
+
+// 計画を立てる。a 自身を含め、Game は書き換えない。
+func (a *Agent) planOn(g *Game) actionPlan {
+	p := actionPlan{agent: a.Clone()}
+
+	if !a.IsOnField() {
+		// フィールドにいないので何もできない
+		return p
+	}
+
+	if p.agent.FrozenTurns > 0 {
+		// 罰として動けない
+		p.agent.FrozenTurns--
+		p.agent.rest(g)
+		return p
+	}
+
+	p.ok, p.err = p.agent.applyOn(g, &p, p.agent.Action)
+	if p.err != nil {
+		// 不正な行動は適用しない。ただし回転は移動できなかった場合にも行う
+		// (moveOn) ので、向きだけは残す。
+		heading := p.agent.Heading
+		p.reject(a, p.err)
+		p.agent.Heading = heading
+	}
+
+	return p
+}
+
+// a が p に従って action を行った結果を p.agent に反映する。
+func (a *Agent) applyOn(g *Game, p *actionPlan, action Action) (bool, error) {
+	switch action := action.(type) {
+	case nil:
 		// 移動しないが別にエラーではない
+		a.rest(g)
 		return false, nil
+	case *ActionMove:
+		return a.moveOn(g, p, &action.Dir, &action.Turn, g.Config.SpeedLimitFor(a).Speed)
+	case *ActionSprint:
+		return a.moveOn(g, p, &action.Dir, &action.Turn, a.sprintSpeedOn(g))
+	case *ActionStay:
+		a.turnOn(g, &action.Turn)
+		a.rest(g)
+		return true, nil
+	case *ActionHide:
+		a.Hidden = true
+		a.rest(g)
+		return true, nil
+	case *ActionSignal:
+		a.Signal = action.Payload
+		a.rest(g)
+		return true, nil
+	case *ActionMessage:
+		if _, ok := action.Action.(*ActionMessage); ok {
+			return false, fmt.Errorf("message action cannot contain another message")
+		}
+
+		if err := a.checkMessage(g, action.Payload); err != nil {
+			return false, err
+		}
+		if action.Payload != "" {
+			p.message = action.Payload
+		}
+
+		inner := action.Action
+		if inner == nil {
+			inner = NewActionStay()
+		}
+		return a.applyOn(g, p, inner)
+	default:
+		return false, fmt.Errorf("unknown action: %v", action.Type())
 	}
+}
 
-	// 移動速度は Speed までに制限する
-	if action.Dir.R >= g.Config.Speed {
-		action.Dir.R = g.Config.Speed
+// dir の方向へ speed までの速さで移動し、turn だけ回転する。実際に適用した
+// 値が分かるように dir と turn は書き換える。
+func (a *Agent) moveOn(
+	g *Game,
+	p *actionPlan,
+	dir *geom.PolarVector,
+	turn *float64,
+	speed float64,
+) (bool, error) {
+	// 負の R で制限をすり抜けられないように正規化しておく
+	*dir = dir.Normalize()
+	requested := dir.R
+
+	// 沼地などでは遅くなる
+	speed *= g.Field.SpeedFactorAt(a.Pos)
+
+	// 移動速度は speed までに制限する
+	if dir.R >= speed {
+		dir.R = speed
 	}
 
+	// 回転は移動できなかった場合にも行う
+	a.turnOn(g, turn)
+
 	// 実際に位置を移動する
-	vecDir := action.Dir.ToVector()
+	vecDir := dir.ToVector()
 	newPos := a.Pos.Add(vecDir).AsCoord()
 
+	if g.Config.Movement == MovementSlide && !g.Field.MovableTo(a, newPos) {
+		// 壁に沿って滑らせる。念のため、滑った先へもまっすぐ移動できるかを
+		// 確かめておく。
+		newPos = g.Field.slide(a, vecDir)
+		if !g.Field.MovableTo(a, newPos) {
+			newPos = g.Field.farthestMovable(a, newPos)
+		}
+		*dir = newPos.Sub(a.Pos.Vector).ToPolarVector()
+	}
+
 	if !g.Field.MovableTo(a, newPos) {
-		// 移動できないので何もしない
-		return false, fmt.Errorf("cannot move to %s", newPos.ToString())
+		err := fmt.Errorf("cannot move to %s", newPos.ToString())
+		if g.Config.InvalidAction.Policy != InvalidClamp {
+			// 移動できないので何もしない
+			return false, err
+		}
+
+		// 移動できるところまでは移動する
+		newPos = g.Field.farthestMovable(a, newPos)
+		dir.R = a.Pos.DistanceTo(newPos)
+		a.Violations++
+		a.Penalty = &Penalty{
+			Policy: InvalidClamp,
+			Reason: err.Error(),
+		}
 	}
 
+	from := a.Pos
 	a.Pos = newPos
+	p.recordMove(a, from, requested, dir.R)
+	if dir.R > 0 {
+		a.drainStamina(g, dir.R)
+	} else {
+		a.rest(g)
+	}
 	return true, nil
 }
 
-func (g *Game) movePoint() {
-	// TODO: Hunter か Runner のどちらかから見るだけでよくない (それにより不整
-	// 合も減らせる)
-	// まずは各 Runner が何人から見られているかを数える (それによって一人の
-	// Hunter がその Runner からもらえる得点がかわってくるので)
-	watchers := make([][]*Agent, len(g.Agents))
+// 現在のスタミナで出せる最大の速さ。Speed を超えた分はスタミナを消費する。
+func (a *Agent) sprintSpeedOn(g *Game) float64 {
+	limit := g.Config.SpeedLimitFor(a)
+	speed := limit.SprintSpeed
+	if g.Config.StaminaDrain > 0 {
+		speed = math.Min(speed, limit.Speed+a.Stamina/g.Config.StaminaDrain)
+	}
+
+	return speed
+}
+
+// Speed を超えて移動した分だけスタミナを消費する。
+func (a *Agent) drainStamina(g *Game, dist float64) {
+	excess := dist - g.Config.SpeedLimitFor(a).Speed
+	if excess <= 0 {
+		return
+	}
+
+	a.Stamina = math.Max(0, a.Stamina-excess*g.Config.StaminaDrain)
+}
+
+// 移動しなかったターンはスタミナが回復する。
+func (a *Agent) rest(g *Game) {
+	a.Stamina = math.Min(a.Stamina+g.Config.StaminaRegen, g.Config.MaxStamina)
+}
+
+// 回転は TurnRate までに制限する
+func (a *Agent) turnOn(g *Game, turn *float64) {
+	*turn = math.Max(-g.Config.TurnRate, math.Min(*turn, g.Config.TurnRate))
+	a.Heading = geom.NormalizeAngle(a.Heading + *turn)
+}
+
+// メッセージの長さを確かめる。Squad ごとの帯域の制限は、同じターンに送ら
+// れる他のメッセージと合わせて resolveMessages で確かめる。
+func (a *Agent) checkMessage(g *Game, payload string) error {
+	if g.Config.MessageMaxLen > 0 && len(payload) > g.Config.MessageMaxLen {
+		return fmt.Errorf(
+			"message too long: %d bytes (max %d)",
+			len(payload), g.Config.MessageMaxLen,
+		)
+	}
+
+	return nil
+}
+
+// このターンに送られたメッセージを、移動後の位置で届く範囲にいる仲間へ届
+// ける。
+func (g *Game) deliverMessages() {
+	for idx := range g.Agents {
+		g.Agents[idx].Inbox = []Message{}
+	}
+
 	for idx := range g.Agents {
-		a := &g.Agents[idx]
-		switch a.Kind {
-		case Hunter:
-			watchers[a.ID] = a.FindWatchingRunners(g, false)
-		case Runner:
-			watchers[a.ID] = a.FindWatchingHunters(g, false)
+		sender := &g.Agents[idx]
+		if sender.Outbox == "" {
+			continue
+		}
+
+		for ridx := range g.Agents {
+			receiver := &g.Agents[ridx]
+			if receiver.ID == sender.ID || receiver.SquadID != sender.SquadID {
+				continue
+			}
+
+			if g.Config.MessageRange > 0 &&
+				sender.Pos.DistanceTo(receiver.Pos) > g.Config.MessageRange {
+				continue
+			}
+
+			receiver.Inbox = append(receiver.Inbox, Message{
+				AgentIDSentFrom: sender.ID,
+				Payload:         sender.Outbox,
+			})
 		}
 	}
+}
 
+func (g *Game) movePoint() {
+	// 見え方は非対称になりうるので、得点の授受は見られている側がどの
+	// Watcher から見られているかだけから決める (見ている側からも数えると食
+	// い違いうる)。
+	deltas := make([]float64, len(g.Agents))
 	for idx := range g.Agents {
-		a := &g.Agents[idx]
-		delta := 0.0
-
-		switch a.Kind {
-		case Hunter:
-			// Hunter の報酬は各 Runner が提供してくれるスコアの和
-			// 各 Runner はスコア 1.0 を見られているハンターへ等分する
-			for _, runner := range watchers[a.ID] {
-				// この Hunter が見ている Runner から点数をもらう。もらえる点
-				// 数は Runner が何人の Hunter から見られているかに依存する。
-				// TODO: ここ単に等分で OK ？
-				gain := 1.0 / float64(len(watchers[runner.ID]))
-				delta += gain
-				a.PointGains = append(a.PointGains, PointGain{
-					AgentIDGainedFrom: runner.ID,
-					Gain:              gain,
-				})
+		target := &g.Agents[idx]
+		for _, rule := range g.Config.Kinds.RulesOn(target.Kind) {
+			watcherKind := rule.Watcher
+			watchers := target.FindWatchingAgents(g, &watcherKind, false)
+			if len(watchers) == 0 {
+				continue
 			}
 
-		case Runner:
-			// Runner は Hunter に対してスコアを提供する
-			// 一人からでも見られている限り 1.0 を供出することになる
-			if len(watchers[a.ID]) > 0 {
-				delta = -1.0
-
-				// 見られている全員に対してスコアを供出する
-				each := delta / float64(len(watchers[a.ID]))
-				for _, hunter := range watchers[a.ID] {
-					a.PointGains = append(a.PointGains, PointGain{
-						AgentIDGainedFrom: hunter.ID,
-						Gain:              each,
-					})
-				}
+			// Guard に守られていれば得点を奪われることはない
+			if rule.Point > 0 && g.isGuarded(target) {
+				continue
+			}
+
+			// Target は一人からでも見られている限り Point を供出し、見てい
+			// る Watcher 全員へ等分する。
+			// TODO: ここ単に等分で OK ？
+			each := rule.Point / float64(len(watchers))
+			deltas[target.ID] -= rule.Point
+			for _, watcher := range watchers {
+				target.PointGains = append(target.PointGains, PointGain{
+					AgentIDGainedFrom: watcher.ID,
+					Gain:              -each,
+				})
+				watcher.PointGains = append(watcher.PointGains, PointGain{
+					AgentIDGainedFrom: target.ID,
+					Gain:              each,
+				})
+				deltas[watcher.ID] += each
+				g.addEvent(Event{
+					Type:     EventPointTransfer,
+					AgentID:  watcher.ID,
+					OtherIDs: []int{target.ID},
+					Value:    each,
+				})
 			}
 		}
+	}
 
-		g.addPointFor(a, delta)
+	for idx := range g.Agents {
+		g.addPointFor(&g.Agents[idx], deltas[idx])
 	}
 }
 
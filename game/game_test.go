@@ -1,8 +1,11 @@
 package game
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
+	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/statiolake/witness-counting-game/geom"
@@ -54,6 +57,55 @@ func TestStateSetup(t *testing.T) {
 	})
 }
 
+func TestValidate(t *testing.T) {
+	t.Run("DefaultIsValid", func(t *testing.T) {
+		if err := DefaultGameConfig().Validate(); err != nil {
+			t.Fatalf("default config is invalid: %v", err)
+		}
+	})
+
+	t.Run("FasterSpeed", func(t *testing.T) {
+		// SprintSpeed を設定しなくても速さを上げられる
+		config := DefaultGameConfig().WithSpeed(3)
+		if err := config.Validate(); err != nil {
+			t.Fatalf("faster speed is rejected: %v", err)
+		}
+
+		if !eq(config.SprintSpeed, 3) {
+			t.Fatalf("sprint speed is not raised: %v", config.SprintSpeed)
+		}
+
+		// 速いままなら SprintSpeed はそのまま
+		config = DefaultGameConfig().WithSprintSpeed(5).WithSpeed(3)
+		if !eq(config.SprintSpeed, 5) {
+			t.Fatalf("sprint speed is changed: %v", config.SprintSpeed)
+		}
+	})
+
+	t.Run("InvalidSpeedLimits", func(t *testing.T) {
+		configs := []*GameConfig{
+			DefaultGameConfig().WithSpeed(-1),
+			DefaultGameConfig().WithSprintSpeed(0.5),
+			DefaultGameConfig().WithKindSpeed(Runner, NewSpeedLimit(2, 1)),
+			DefaultGameConfig().WithKindSpeed(Runner, NewSpeedLimit(math.NaN(), 1)),
+			DefaultGameConfig().WithKindSpeed(Hunter, NewSpeedLimit(1, math.NaN())),
+			DefaultGameConfig().WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(
+						NewAgentConfig("agent-01h", Hunter).
+							WithSpeed(NewSpeedLimit(-1, 1)),
+					),
+			),
+		}
+
+		for idx, config := range configs {
+			if err := config.Validate(); err == nil {
+				t.Fatalf("invalid config #%d accepted", idx)
+			}
+		}
+	})
+}
+
 func TestApplyActionOn(t *testing.T) {
 	t.Run("RightAbove45", func(t *testing.T) {
 		g := dummyGame()
@@ -118,120 +170,2500 @@ func TestApplyActionOn(t *testing.T) {
 			t.Fatalf("too fast move caused error: %v", err)
 		}
 
-		if !ok {
-			t.Fatalf("too fast move was cancelled")
+		if !ok {
+			t.Fatalf("too fast move was cancelled")
+		}
+
+		// 実際にはスピード程度に抑えられていることを確認する
+		expected := geom.NewCoord(1, 0)
+		actual := agent.Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+	})
+
+	t.Run("TurnInPlace", func(t *testing.T) {
+		g := dummyGame()
+		agent := &g.Agents[0]
+
+		agent.Action = NewActionTurn(math.Pi / 8)
+
+		ok, err := agent.applyActionOn(&g)
+		if err != nil {
+			t.Fatalf("turn didn't apply: %v", err)
+		}
+
+		if !ok {
+			t.Fatalf("turn not applied even though not nil")
+		}
+
+		if !eq(agent.Heading, math.Pi/8) {
+			t.Fatalf("expected heading %v but actual %v", math.Pi/8, agent.Heading)
+		}
+
+		expected := geom.NewCoord(0, 0)
+		actual := agent.Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+	})
+
+	t.Run("DoNotTurnTooFast", func(t *testing.T) {
+		g := dummyGame()
+		agent := &g.Agents[0]
+
+		// 上へ移動しつつ時計回りに大きく回転しようとしてみる
+		agent.Action = NewActionMoveAndTurn(
+			geom.NewPolarVector(1, math.Pi/2),
+			-math.Pi,
+		)
+
+		if _, err := agent.applyActionOn(&g); err != nil {
+			t.Fatalf("action didn't apply: %v", err)
+		}
+
+		// 回転は TurnRate 程度に抑えられていることを確認する
+		if !eq(agent.Heading, -g.Config.TurnRate) {
+			t.Fatalf(
+				"expected heading %v but actual %v",
+				-g.Config.TurnRate, agent.Heading,
+			)
+		}
+
+		expected := geom.NewCoord(0, 1)
+		actual := agent.Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+	})
+
+	t.Run("HeadingWrapsAround", func(t *testing.T) {
+		g := dummyGame()
+		agent := &g.Agents[0]
+		agent.Heading = math.Pi - 0.1
+
+		agent.Action = NewActionTurn(0.2)
+
+		if _, err := agent.applyActionOn(&g); err != nil {
+			t.Fatalf("turn didn't apply: %v", err)
+		}
+
+		if !eq(agent.Heading, -math.Pi+0.1) {
+			t.Fatalf(
+				"expected heading %v but actual %v",
+				-math.Pi+0.1, agent.Heading,
+			)
+		}
+	})
+
+	t.Run("InvalidAgent", func(t *testing.T) {
+		g := dummyGame()
+		agent := Agent{
+			ID:         0,
+			InSquadID:  0,
+			SquadID:    0,
+			Name:       "",
+			Kind:       0,
+			Pos:        geom.NewCoord(0, 0),
+			Point:      0,
+			PointGains: []PointGain{},
+			Action:     &ActionMove{Dir: geom.NewPolarVector(1, 0)},
+		}
+
+		ok, err := agent.applyActionOn(&g)
+
+		if err == nil {
+			t.Fatalf("invalid agent accepted")
+		}
+
+		if ok {
+			t.Fatalf("error but returned true")
+		}
+	})
+
+	t.Run("RunSpecifiedTime", func(t *testing.T) {
+		count := 0
+
+		g := dummyGame()
+		for !g.IsFinished() {
+			if count > g.Config.Time {
+				t.Fatalf(
+					"Turn elapsed without stopping game (%d turns (in %d turns) left)",
+					g.TimeRemaining,
+					g.Config.Time,
+				)
+			}
+			g.StartTurn()
+			g.Agents[0].Action = &ActionMove{
+				Dir: geom.NewPolarVector(0.01, 0),
+			}
+
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+
+			count++
+		}
+
+		expected := geom.NewCoord(1, 0)
+		actual := g.Agents[0].Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+
+		if count != g.Config.Time {
+			t.Fatalf("Only %d turn (in %d turn) passed", count, g.Config.Time)
+		}
+
+		if !g.IsFinished() {
+			t.Fatalf("IsFinished() is inconsistent")
+		}
+	})
+
+	t.Run("RunSpecifiedTimeErrornous", func(t *testing.T) {
+		count := 0
+
+		g := dummyGame()
+		for !g.IsFinished() {
+			if count > g.Config.Time {
+				t.Fatalf(
+					"Turn elapsed without stopping game (%d turns (in %d turns) left)",
+					g.TimeRemaining,
+					g.Config.Time,
+				)
+			}
+			g.StartTurn()
+			tooFastSpeed := g.Config.Field.Rect.RB.X * 2 /
+				float64(g.Config.Time)
+			g.Agents[0].Action = &ActionMove{
+				Dir: geom.NewPolarVector(tooFastSpeed, 0),
+			}
+
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+
+			count++
+		}
+
+		expected := geom.NewCoord(g.Config.Field.Rect.RB.X, 0)
+		actual := g.Agents[0].Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+
+		if count != g.Config.Time {
+			t.Fatalf("Only %d turn (in %d turn) passed", count, g.Config.Time)
+		}
+
+		if !g.IsFinished() {
+			t.Fatalf("IsFinished() is inconsistent")
+		}
+	})
+}
+
+func TestActions(t *testing.T) {
+	t.Run("Sprint", func(t *testing.T) {
+		g := dummyGame()
+		agent := &g.Agents[0]
+
+		agent.Action = NewActionSprint(geom.NewPolarVector(1e5, 0))
+
+		if _, err := agent.applyActionOn(&g); err != nil {
+			t.Fatalf("sprint didn't apply: %v", err)
+		}
+
+		// SprintSpeed 程度に抑えられていることを確認する
+		expected := geom.NewCoord(g.Config.SprintSpeed, 0)
+		actual := agent.Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+	})
+
+	t.Run("Stamina", func(t *testing.T) {
+		g := dummyGame()
+		agent := &g.Agents[0]
+		cfg := &g.Config
+
+		// スタミナが尽きるまで全力で走る
+		turns := 0
+		for ; agent.Stamina > 0; turns++ {
+			before := agent.Stamina
+			agent.Action = NewActionSprint(geom.NewPolarVector(1e5, 0))
+			if _, err := agent.applyActionOn(&g); err != nil {
+				t.Fatalf("sprint didn't apply: %v", err)
+			}
+
+			if !(agent.Stamina < before) {
+				t.Fatalf("stamina did not drain: %v to %v", before, agent.Stamina)
+			}
+		}
+
+		// スタミナを使い切るまでに、Speed で進む分に加えてスタミナの分だけ
+		// 余計に進んでいるはず
+		expectedX := cfg.MaxStamina/cfg.StaminaDrain + float64(turns)*cfg.Speed
+		if !eq(agent.Pos.X, expectedX) {
+			t.Fatalf("expected x %v but actual %v", expectedX, agent.Pos.X)
+		}
+
+		// スタミナがない状態では Speed までしか出せない
+		before := agent.Pos
+		agent.Action = NewActionSprint(geom.NewPolarVector(1e5, 0))
+		if _, err := agent.applyActionOn(&g); err != nil {
+			t.Fatalf("sprint didn't apply: %v", err)
+		}
+
+		if !eq(agent.Pos.X-before.X, cfg.Speed) {
+			t.Fatalf(
+				"exhausted agent moved %v faster than speed",
+				agent.Pos.X-before.X,
+			)
+		}
+
+		// 休むと回復する
+		agent.Action = NewActionStay()
+		if _, err := agent.applyActionOn(&g); err != nil {
+			t.Fatalf("stay didn't apply: %v", err)
+		}
+
+		if !eq(agent.Stamina, cfg.StaminaRegen) {
+			t.Fatalf(
+				"expected stamina %v but actual %v",
+				cfg.StaminaRegen, agent.Stamina,
+			)
+		}
+
+		// 巡航速度で移動してもスタミナは変化しない
+		agent.Action = NewActionMove(geom.NewPolarVector(cfg.Speed, 0))
+		if _, err := agent.applyActionOn(&g); err != nil {
+			t.Fatalf("move didn't apply: %v", err)
+		}
+
+		if !eq(agent.Stamina, cfg.StaminaRegen) {
+			t.Fatalf(
+				"expected stamina %v but actual %v",
+				cfg.StaminaRegen, agent.Stamina,
+			)
+		}
+	})
+
+	t.Run("SpeedLimits", func(t *testing.T) {
+		// Runner は速く、Hunter は遅く、ただし slow-runner だけは個別に遅く
+		// する。
+		g := DefaultGameConfig().
+			WithKindSpeed(Hunter, NewSpeedLimit(0.5, 1.0)).
+			WithKindSpeed(Runner, NewSpeedLimit(1.5, 3.0)).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("hunter", Hunter)).
+					WithAgentAdded(NewAgentConfig("runner", Runner)).
+					WithAgentAdded(
+						NewAgentConfig("slow-runner", Runner).
+							WithSpeed(NewSpeedLimit(0.25, 0.25)),
+					),
+			).
+			BuildGame()
+
+		asserts := []struct {
+			action   Action
+			expected float64
+		}{
+			{NewActionMove(geom.NewPolarVector(1e5, 0)), 0.5},
+			{NewActionMove(geom.NewPolarVector(1e5, 0)), 1.5},
+			{NewActionMove(geom.NewPolarVector(1e5, 0)), 0.25},
+			{NewActionSprint(geom.NewPolarVector(1e5, 0)), 1.0},
+			{NewActionSprint(geom.NewPolarVector(1e5, 0)), 3.0},
+			{NewActionSprint(geom.NewPolarVector(1e5, 0)), 0.25},
+		}
+
+		for idx, assert := range asserts {
+			agent := &g.Agents[idx%len(g.Agents)]
+			before := agent.Pos
+			agent.Action = assert.action
+			if _, err := agent.applyActionOn(&g); err != nil {
+				t.Fatalf("action didn't apply: %v", err)
+			}
+
+			if moved := agent.Pos.X - before.X; !eq(moved, assert.expected) {
+				t.Fatalf(
+					"agent %s moved %v but expected %v",
+					g.DescribeAgent(agent), moved, assert.expected,
+				)
+			}
+		}
+	})
+
+	t.Run("NegativeRadius", func(t *testing.T) {
+		g := dummyGame()
+		agent := &g.Agents[0]
+
+		// 負の R で速度制限をすり抜けられないことを確認する
+		agent.Action = NewActionMove(geom.NewPolarVector(-1e5, 0))
+
+		if _, err := agent.applyActionOn(&g); err != nil {
+			t.Fatalf("move didn't apply: %v", err)
+		}
+
+		expected := geom.NewCoord(-g.Config.Speed, 0)
+		actual := agent.Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+	})
+
+	t.Run("Stay", func(t *testing.T) {
+		g := dummyGame()
+		agent := &g.Agents[0]
+
+		agent.Action = NewActionStay()
+
+		ok, err := agent.applyActionOn(&g)
+		if err != nil {
+			t.Fatalf("stay didn't apply: %v", err)
+		}
+
+		if !ok {
+			t.Fatalf("stay not applied even though not nil")
+		}
+
+		expected := geom.NewCoord(0, 0)
+		actual := agent.Pos
+		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
+			t.Fatalf("expected %v but actual %v", expected, actual)
+		}
+	})
+
+	t.Run("Hide", func(t *testing.T) {
+		// Runner が Hunter から HideRange より遠くに潜んでいる場合、Runner
+		// からは Hunter が見えるが Hunter からは Runner が見えない。
+		g := DefaultGameConfig().
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(
+						NewAgentConfig("agent-01h", Hunter).
+							WithInitPos(geom.NewCoord(-10, 0)),
+					),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).
+							WithInitPos(geom.NewCoord(10, 0)),
+					),
+			).
+			BuildGame()
+
+		hunter := &g.Agents[0]
+		runner := &g.Agents[1]
+
+		g.StartTurn()
+		runner.Action = NewActionHide()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if !runner.IsWatching(hunter, &g) || hunter.IsWatching(runner, &g) {
+			t.Fatalf("hiding runner is visible from far hunter")
+		}
+
+		if !eq(hunter.Point, 0.0) || !eq(runner.Point, 0.0) {
+			t.Fatalf(
+				"point moved from hiding runner: %v and %v",
+				hunter.Point, runner.Point,
+			)
+		}
+
+		if len(g.GetKnowledgeFor(hunter).Watchers) != 1 {
+			t.Fatalf("hunter knows hiding runner")
+		}
+
+		if len(g.GetKnowledgeFor(runner).Watchers) != 2 {
+			t.Fatalf("hiding runner does not know hunter")
+		}
+
+		// 次のターンは潜むのをやめるので見つかる
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if !eq(hunter.Point, 1.0) || !eq(runner.Point, -1.0) {
+			t.Fatalf(
+				"point did not move from runner: %v and %v",
+				hunter.Point, runner.Point,
+			)
+		}
+	})
+
+	t.Run("Signal", func(t *testing.T) {
+		g := dummyGame()
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionSignal("hello")
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		knowledge := g.GetKnowledgeFor(&g.Agents[1])
+		for _, watcher := range knowledge.Watchers {
+			if watcher.ID == 0 && watcher.Signal != "hello" {
+				t.Fatalf("signal is not visible: %q", watcher.Signal)
+			}
+		}
+
+		g.StartTurn()
+		if g.Agents[0].Signal != "" {
+			t.Fatalf("signal is not reset: %q", g.Agents[0].Signal)
+		}
+	})
+
+	t.Run("SnapshotJSON", func(t *testing.T) {
+		g := dummyGame()
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMoveAndTurn(geom.NewPolarVector(1, 0), 0.1)
+		g.Agents[1].Action = NewActionSprint(geom.NewPolarVector(1, 0))
+		g.Agents[2].Action = NewActionTurn(0.1)
+		g.Agents[3].Action = NewActionHide()
+		g.Agents[4].Action = NewActionSignal("hello")
+		g.Agents[5].Action = NewActionMessage("hello", NewActionHide())
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		data, err := json.Marshal(g)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+
+		var decoded Game
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+
+		for idx := range g.Agents {
+			expected := g.Agents[idx].Action
+			actual := decoded.Agents[idx].Action
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf(
+					"action of agent %d is not preserved: expected %#v but %#v",
+					idx, expected, actual,
+				)
+			}
+		}
+	})
+}
+
+func TestAreas(t *testing.T) {
+	// 原点の Hunter と (10, 0) の Runner がいて、その間に領域を置く
+	areaGame := func(area *AreaConfig) Game {
+		return DefaultGameConfig().
+			WithFieldConfig(DefaultFieldConfig().WithAreaAdded(area)).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).
+							WithInitPos(geom.NewCoord(10, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	square := func(minX, minY, maxX, maxY float64) geom.Polygon {
+		return geom.NewPolygonFromRect(geom.NewRectFromPoints(minX, minY, maxX, maxY))
+	}
+
+	t.Run("Concealment", func(t *testing.T) {
+		g := areaGame(NewAreaConfig(square(8, -2, 12, 2)).WithConcealment(3))
+		hunter := &g.Agents[0]
+		runner := &g.Agents[1]
+
+		if hunter.IsWatching(runner, &g) {
+			t.Fatalf("runner in bush is visible from far")
+		}
+
+		if !runner.IsWatching(hunter, &g) {
+			t.Fatalf("runner in bush cannot see outside")
+		}
+
+		hunter.Pos = geom.NewCoord(7.5, 0)
+		if !hunter.IsWatching(runner, &g) {
+			t.Fatalf("runner in bush is not visible from near")
+		}
+	})
+
+	t.Run("SlowTerrain", func(t *testing.T) {
+		g := areaGame(NewAreaConfig(square(-1, -1, 1, 1)).WithSpeedFactor(0.5))
+		hunter := &g.Agents[0]
+
+		hunter.Action = NewActionMove(geom.NewPolarVector(1e5, 0))
+		if _, err := hunter.applyActionOn(&g); err != nil {
+			t.Fatalf("move didn't apply: %v", err)
+		}
+
+		if !eq(hunter.Pos.X, 0.5) {
+			t.Fatalf("expected x %v but actual %v", 0.5, hunter.Pos.X)
+		}
+	})
+
+	t.Run("NoGo", func(t *testing.T) {
+		g := areaGame(NewAreaConfig(square(0.5, -1, 0.7, 1)).WithNoGo())
+		hunter := &g.Agents[0]
+
+		// 薄い立ち入り禁止区域を飛び越えることはできない
+		hunter.Action = NewActionSprint(geom.NewPolarVector(1e5, 0))
+		ok, err := hunter.applyActionOn(&g)
+		if err == nil || ok {
+			t.Fatalf("moving over no-go area accepted")
+		}
+
+		// 中に入ることもできない
+		hunter.Action = NewActionMove(geom.NewPolarVector(0.6, 0))
+		ok, err = hunter.applyActionOn(&g)
+		if err == nil || ok {
+			t.Fatalf("moving into no-go area accepted")
+		}
+
+		// 逆方向には動ける
+		hunter.Action = NewActionMove(geom.NewPolarVector(1, math.Pi))
+		if _, err := hunter.applyActionOn(&g); err != nil {
+			t.Fatalf("move didn't apply: %v", err)
+		}
+	})
+}
+
+func TestDynamicObstructions(t *testing.T) {
+	// 原点の Hunter と (2, 0) の Runner の間に遮蔽物を置く
+	obstGame := func(obst *ObstructionConfig) Game {
+		return DefaultGameConfig().
+			WithFieldConfig(DefaultFieldConfig().WithObstructionAdded(*obst)).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).
+							WithInitPos(geom.NewCoord(2, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	wall := geom.NewSegment(geom.NewCoord(1, -1), geom.NewCoord(1, 1))
+
+	t.Run("Door", func(t *testing.T) {
+		// 閉, 閉, 開 の繰り返しを Phase だけずらしたもの
+		cases := []struct {
+			phase    int
+			expected []bool
+		}{
+			{0, []bool{false, false, true, false, false, true}},
+			{1, []bool{false, true, false, false, true, false}},
+			{-1, []bool{true, false, false, true, false, false}},
+			{-5, []bool{false, true, false, false, true, false}},
+		}
+
+		for _, c := range cases {
+			g := obstGame(NewObstructionConfig(wall).WithDoor(2, 1, c.phase))
+			hunter := &g.Agents[0]
+			runner := &g.Agents[1]
+
+			for turn, visible := range c.expected {
+				if hunter.IsWatching(runner, &g) != visible {
+					t.Fatalf(
+						"phase %d, turn %d: visibility should be %v",
+						c.phase, turn, visible,
+					)
+				}
+
+				knowledge := g.GetKnowledgeFor(hunter)
+				if knowledge.Field.Obsts[0].Open != visible {
+					t.Fatalf(
+						"phase %d, turn %d: door state is not in knowledge",
+						c.phase, turn,
+					)
+				}
+
+				g.StartTurn()
+				if err := g.CommitTurn(); err != nil {
+					t.Fatalf("commit turn failed: %v", err)
+				}
+			}
+		}
+	})
+
+	t.Run("MovingWall", func(t *testing.T) {
+		// 2 ターンかけて上へ 3 だけ動き、また 2 ターンかけて戻ってくる
+		g := obstGame(NewObstructionConfig(wall).WithPath(
+			2,
+			geom.NewVector(0, 0),
+			geom.NewVector(0, 3),
+		))
+		hunter := &g.Agents[0]
+		runner := &g.Agents[1]
+
+		expectedY := []float64{-1, 0.5, 2, 0.5, -1}
+		for turn, y := range expectedY {
+			snapshot := g.Clone()
+			if actual := snapshot.Field.Obsts[0].Segment.A.Y; !eq(actual, y) {
+				t.Fatalf("turn %d: expected y %v but %v", turn, y, actual)
+			}
+
+			visible := y > 0
+			if hunter.IsWatching(runner, &g) != visible {
+				t.Fatalf("turn %d: visibility should be %v", turn, visible)
+			}
+
+			g.StartTurn()
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+		}
+	})
+}
+
+func TestShrink(t *testing.T) {
+	// 中央と隅に一人ずつ置く。同じ Squad なので得点の授受はない。
+	shrinkGame := func(shrink *ShrinkConfig) Game {
+		return DefaultGameConfig().
+			WithShrink(shrink).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)).
+					WithAgentAdded(
+						NewAgentConfig("agent-01r", Runner).
+							WithInitPos(geom.NewCoord(45, 45)),
+					),
+			).
+			BuildGame()
+	}
+
+	finalRect := geom.NewRectFromPoints(-10, -10, 10, 10)
+
+	t.Run("Validate", func(t *testing.T) {
+		config := DefaultGameConfig().WithShrink(
+			NewShrinkConfig(0, 10, geom.NewRectFromPoints(-100, -100, 100, 100)),
+		)
+		if err := config.Validate(); err == nil {
+			t.Fatalf("final rect larger than field accepted")
+		}
+	})
+
+	t.Run("Penalty", func(t *testing.T) {
+		g := shrinkGame(NewShrinkConfig(0, 10, finalRect).WithPenalty(0.5))
+		center := &g.Agents[0]
+		corner := &g.Agents[1]
+
+		for turn := 0; turn < 10; turn++ {
+			g.StartTurn()
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+		}
+
+		if !reflect.DeepEqual(g.Field.SafeRect, finalRect) {
+			t.Fatalf("safe rect did not shrink: %v", g.Field.SafeRect)
+		}
+
+		// 場外にいても動けはする
+		if !reflect.DeepEqual(g.Field.Rect, g.Config.Field.Rect) {
+			t.Fatalf("field itself shrank: %v", g.Field.Rect)
+		}
+
+		if !eq(center.Point, 0) {
+			t.Fatalf("agent inside lost point: %v", center.Point)
+		}
+
+		// 安全地帯の端は 1 ターンに 4 ずつ縮むので、45 より内側になる 2 ター
+		// ン目以降の 8 ターン分だけ得点を失う
+		if !eq(corner.Point, -0.5*8) {
+			t.Fatalf("unexpected point of agent outside: %v", corner.Point)
+		}
+
+		gains := corner.PointGains
+		if len(gains) != 1 || gains[0].AgentIDGainedFrom != NoAgentID {
+			t.Fatalf("penalty is not recorded: %v", gains)
+		}
+	})
+
+	t.Run("PenaltyOffField", func(t *testing.T) {
+		g := shrinkGame(NewShrinkConfig(0, 10, finalRect).WithPenalty(0.5))
+		corner := &g.Agents[1]
+
+		// フィールドから取り除かれていれば場外にいても得点を失わない
+		corner.Disqualified = true
+		for turn := 0; turn < 10; turn++ {
+			g.StartTurn()
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+		}
+
+		if !eq(corner.Point, 0) || len(g.EventsOf(EventPointTransfer)) != 0 {
+			t.Fatalf("agent off field lost point: %v", corner.Point)
+		}
+	})
+
+	t.Run("Push", func(t *testing.T) {
+		g := shrinkGame(NewShrinkConfig(0, 10, finalRect).WithPush())
+		corner := &g.Agents[1]
+
+		for turn := 0; turn < 10; turn++ {
+			g.StartTurn()
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+
+			if !g.Field.Rect.Contains(corner.Pos) {
+				t.Fatalf("turn %d: agent is outside: %v", turn, corner.Pos)
+			}
+		}
+
+		if !reflect.DeepEqual(g.Field.Rect, finalRect) {
+			t.Fatalf("field did not shrink: %v", g.Field.Rect)
+		}
+
+		if !eq(corner.Pos.X, 10) || !eq(corner.Pos.Y, 10) || !eq(corner.Point, 0) {
+			t.Fatalf("unexpected agent state: %v, %v", corner.Pos, corner.Point)
+		}
+
+		// 縮んだフィールドの外へは動けない
+		corner.Action = NewActionMove(geom.NewPolarVector(1, 0))
+		if ok, err := corner.applyActionOn(&g); ok || err == nil {
+			t.Fatalf("moving outside of shrunk field accepted")
+		}
+	})
+
+	pushGame := func(field *FieldConfig) Game {
+		return DefaultGameConfig().
+			WithFieldConfig(field).
+			WithShrink(NewShrinkConfig(0, 10, finalRect).WithPush()).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)).
+					WithAgentAdded(
+						NewAgentConfig("agent-01r", Runner).
+							WithInitPos(geom.NewCoord(45, 45)),
+					),
+			).
+			BuildGame()
+	}
+
+	t.Run("PushAroundNoGo", func(t *testing.T) {
+		// 押し込まれる途中にある立ち入り禁止区域は、その縁に沿って避ける
+		noGo := geom.NewPolygonFromRect(geom.NewRectFromPoints(20, 30, 40, 50))
+		g := pushGame(DefaultFieldConfig().WithAreaAdded(NewAreaConfig(noGo).WithNoGo()))
+		corner := &g.Agents[1]
+
+		for turn := 0; turn < 10; turn++ {
+			g.StartTurn()
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+
+			if noGo.Contains(corner.Pos) {
+				t.Fatalf("turn %d: agent is pushed into no-go area: %v", turn, corner.Pos)
+			}
+		}
+
+		// 区域を回り込んだ後は最後まで押し込まれる
+		if !eq(corner.Pos.X, 10) || !eq(corner.Pos.Y, 10) {
+			t.Fatalf("unexpected agent position: %v", corner.Pos)
+		}
+	})
+
+	t.Run("PushBlockedBySolid", func(t *testing.T) {
+		// 押し込まれても通り抜けられない壁は越えない
+		wall := geom.NewSegment(geom.NewCoord(30, -50), geom.NewCoord(30, 50))
+		g := pushGame(DefaultFieldConfig().WithObstructionAdded(
+			*NewObstructionConfig(wall).WithSolid(),
+		))
+		corner := &g.Agents[1]
+
+		for turn := 0; turn < 10; turn++ {
+			g.StartTurn()
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+
+			if corner.Pos.X < 30 {
+				t.Fatalf("turn %d: agent is pushed through wall: %v", turn, corner.Pos)
+			}
+		}
+
+		// 壁に沿って押せるところまでは押し込まれる
+		if !eq(corner.Pos.Y, 10) {
+			t.Fatalf("agent is not pushed along wall: %v", corner.Pos)
+		}
+	})
+}
+
+func TestCapture(t *testing.T) {
+	// squad-01 の Hunter の隣に squad-02 の Runner を置く。
+	captureGame := func(capture *CaptureConfig) Game {
+		return DefaultGameConfig().
+			WithCapture(capture).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).
+							WithInitPos(geom.NewCoord(3, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	commit := func(t *testing.T, g *Game) {
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+	}
+
+	t.Run("Validate", func(t *testing.T) {
+		config := DefaultGameConfig().WithCapture(NewCaptureConfig(5, 0))
+		if err := config.Validate(); err == nil {
+			t.Fatalf("zero capture turns accepted")
+		}
+	})
+
+	t.Run("Capture", func(t *testing.T) {
+		g := captureGame(NewCaptureConfig(5, 3))
+		hunter := &g.Agents[0]
+		runner := &g.Agents[1]
+
+		for turn := 0; turn < 2; turn++ {
+			commit(t, &g)
+			if runner.Captured || len(g.EventsOf(EventCapture)) != 0 {
+				t.Fatalf("turn %d: captured too early", turn)
+			}
+		}
+
+		commit(t, &g)
+		if !runner.Captured {
+			t.Fatalf("runner is not captured")
+		}
+
+		captures := g.EventsOf(EventCapture)
+		if len(captures) != 1 || captures[0].AgentID != runner.ID ||
+			!reflect.DeepEqual(captures[0].OtherIDs, []int{hunter.ID}) {
+			t.Fatalf("capture is not recorded: %v", captures)
+		}
+
+		// 捕まった Runner は見えないので、もう得点は動かない
+		point := hunter.Point
+		commit(t, &g)
+		if !eq(hunter.Point, point) || len(g.EventsOf(EventCapture)) != 0 {
+			t.Fatalf("captured runner still in play: %v, %v", hunter.Point, g.Events)
+		}
+
+		// 行動もできない
+		g.StartTurn()
+		runner.Action = NewActionMove(geom.NewPolarVector(1, 0))
+		if ok, err := runner.applyActionOn(&g); ok || err != nil {
+			t.Fatalf("captured runner acted: %v, %v", ok, err)
+		}
+	})
+
+	t.Run("OutOfRange", func(t *testing.T) {
+		g := captureGame(NewCaptureConfig(2, 1))
+		runner := &g.Agents[1]
+
+		commit(t, &g)
+		if runner.Captured || runner.CaptureProgress != 0 {
+			t.Fatalf("runner out of range captured: %v", runner.CaptureProgress)
+		}
+	})
+
+	t.Run("ProgressResets", func(t *testing.T) {
+		g := captureGame(NewCaptureConfig(4, 2))
+		runner := &g.Agents[1]
+
+		commit(t, &g)
+		if runner.CaptureProgress != 1 {
+			t.Fatalf("unexpected progress: %d", runner.CaptureProgress)
+		}
+
+		// 一度でも範囲外に出れば最初からやり直しになる
+		g.StartTurn()
+		runner.Action = NewActionSprint(geom.NewPolarVector(2, 0))
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+		if runner.Captured || runner.CaptureProgress != 0 {
+			t.Fatalf("progress did not reset: %d", runner.CaptureProgress)
+		}
+	})
+
+	t.Run("Respawn", func(t *testing.T) {
+		g := captureGame(NewCaptureConfig(5, 1).WithRespawn(2))
+		runner := &g.Agents[1]
+
+		commit(t, &g)
+		if !runner.Captured || runner.RespawnIn != 2 {
+			t.Fatalf("unexpected capture state: %v, %d", runner.Captured, runner.RespawnIn)
+		}
+
+		g.StartTurn()
+		runner.Pos = geom.NewCoord(40, 40)
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+		if !runner.Captured || len(g.EventsOf(EventRespawn)) != 0 {
+			t.Fatalf("respawned too early")
+		}
+
+		commit(t, &g)
+		respawns := g.EventsOf(EventRespawn)
+		if runner.Captured || len(respawns) != 1 || respawns[0].AgentID != runner.ID {
+			t.Fatalf("runner did not respawn: %v", respawns)
+		}
+
+		if !reflect.DeepEqual(runner.Pos, geom.NewCoord(3, 0)) {
+			t.Fatalf("respawned at unexpected position: %v", runner.Pos)
+		}
+	})
+
+	t.Run("NoRespawn", func(t *testing.T) {
+		g := captureGame(NewCaptureConfig(5, 1))
+		runner := &g.Agents[1]
+
+		// 復帰しないなら復帰までのターン数も数えない
+		for turn := 0; turn < 4; turn++ {
+			commit(t, &g)
+			if !runner.Captured || runner.RespawnIn != 0 {
+				t.Fatalf(
+					"turn %d: unexpected capture state: %v, %d",
+					turn, runner.Captured, runner.RespawnIn,
+				)
+			}
+		}
+	})
+}
+
+func TestResult(t *testing.T) {
+	// squad-01 の Hunter が squad-02 の Runner を見続け、毎ターン 1 点ずつ
+	// 差が開いていく。
+	resultGame := func(config *GameConfig) Game {
+		return config.
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).
+							WithInitPos(geom.NewCoord(3, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	// 終わるまで進めて、かかったターン数を返す
+	run := func(t *testing.T, g *Game) int {
+		turns := 0
+		for !g.IsFinished() {
+			g.StartTurn()
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+			turns++
+		}
+
+		if g.Result == nil {
+			t.Fatalf("finished without result")
+		}
+
+		return turns
+	}
+
+	tests := []struct {
+		name   string
+		config *GameConfig
+		turns  int
+		reason EndReason
+	}{
+		{
+			name:   "TimeUp",
+			config: DefaultGameConfig().WithTime(5),
+			turns:  5,
+			reason: EndReasonTimeUp,
+		},
+		{
+			name: "ScoreThreshold",
+			config: DefaultGameConfig().WithEndConditions(
+				NewEndConditions().WithScoreThreshold(3),
+			),
+			turns:  3,
+			reason: EndReasonScoreThreshold,
+		},
+		{
+			name: "LeadMargin",
+			config: DefaultGameConfig().WithEndConditions(
+				NewEndConditions().WithLeadMargin(4),
+			),
+			turns:  2,
+			reason: EndReasonLeadMargin,
+		},
+		{
+			name: "AllRunnersCaptured",
+			config: DefaultGameConfig().
+				WithCapture(NewCaptureConfig(5, 4)).
+				WithEndConditions(NewEndConditions().WithAllRunnersCaptured()),
+			turns:  4,
+			reason: EndReasonAllRunnersCaptured,
+		},
+		{
+			name: "Idle",
+			config: DefaultGameConfig().WithEndConditions(
+				NewEndConditions().WithIdleTurns(6),
+			),
+			turns:  6,
+			reason: EndReasonIdle,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := resultGame(test.config)
+			turns := run(t, &g)
+			if turns != test.turns || g.Result.Reason != test.reason {
+				t.Fatalf(
+					"finished after %d turns by %q, expected %d turns by %q",
+					turns, g.Result.Reason, test.turns, test.reason,
+				)
+			}
+
+			if g.Result.Winner != 0 || !reflect.DeepEqual(g.Result.Ranking, []int{0, 1}) {
+				t.Fatalf("unexpected result: %+v", g.Result)
+			}
+
+			// 終わったゲームはそれ以上進められない
+			if err := g.CommitTurn(); err == nil {
+				t.Fatalf("finished game was stepped")
+			}
+		})
+	}
+
+	t.Run("Draw", func(t *testing.T) {
+		g := dummyGame()
+		run(t, &g)
+		if g.Result.Winner != NoSquadID || len(g.Result.Ranking) != len(g.Squads) {
+			t.Fatalf("unexpected result of draw: %+v", g.Result)
+		}
+	})
+
+	t.Run("IdleResetsOnMove", func(t *testing.T) {
+		g := resultGame(DefaultGameConfig().WithEndConditions(
+			NewEndConditions().WithIdleTurns(2),
+		))
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMove(geom.NewPolarVector(1, 0))
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if g.IdleTurns != 0 || g.IsFinished() {
+			t.Fatalf("move is not counted: %d", g.IdleTurns)
+		}
+	})
+}
+
+func TestEvents(t *testing.T) {
+	// squad-01 の Hunter から 4 離れたところに squad-02 の Runner を置く。
+	eventGame := func() Game {
+		return DefaultGameConfig().
+			WithHideRange(2).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).
+							WithInitPos(geom.NewCoord(4, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	t.Run("Moves", func(t *testing.T) {
+		g := eventGame()
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMove(geom.NewPolarVector(3, 0))
+		g.Agents[1].Action = NewActionMove(geom.NewPolarVector(1, math.Pi/2))
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		clamped := g.EventsOf(EventMoveClamped)
+		if len(clamped) != 1 || clamped[0].AgentID != 0 || !eq(clamped[0].Value, 1) {
+			t.Fatalf("clamped move is not recorded: %v", clamped)
+		}
+
+		applied := g.EventsOf(EventMoveApplied)
+		if len(applied) != 1 || applied[0].AgentID != 1 ||
+			!reflect.DeepEqual(applied[0].From, geom.NewCoord(4, 0)) {
+			t.Fatalf("applied move is not recorded: %v", applied)
+		}
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMove(geom.NewPolarVector(1, math.Pi))
+		g.Agents[0].Pos = g.Field.Rect.LT
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		rejected := g.EventsOf(EventActionRejected)
+		if len(rejected) != 1 || rejected[0].AgentID != 0 || rejected[0].Reason == "" {
+			t.Fatalf("rejected move is not recorded: %v", rejected)
+		}
+	})
+
+	t.Run("Sightings", func(t *testing.T) {
+		g := eventGame()
+
+		// 身を潜めると遠くの Hunter からは見えなくなる
+		g.StartTurn()
+		g.Agents[1].Action = NewActionHide()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		lost := g.EventsOf(EventSightingLost)
+		if len(lost) != 1 || lost[0].AgentID != 0 ||
+			!reflect.DeepEqual(lost[0].OtherIDs, []int{1}) {
+			t.Fatalf("lost sighting is not recorded: %v", lost)
+		}
+
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		gained := g.EventsOf(EventSightingGained)
+		if len(gained) != 1 || gained[0].AgentID != 0 ||
+			!reflect.DeepEqual(gained[0].OtherIDs, []int{1}) {
+			t.Fatalf("gained sighting is not recorded: %v", gained)
+		}
+
+		transfers := g.EventsOf(EventPointTransfer)
+		if len(transfers) != 1 || transfers[0].AgentID != 0 || !eq(transfers[0].Value, 1) {
+			t.Fatalf("point transfer is not recorded: %v", transfers)
+		}
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		g := eventGame()
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		cloned := g.Clone()
+		if !reflect.DeepEqual(cloned.Events, g.Events) {
+			t.Fatalf("events are not cloned")
+		}
+
+		cloned.Events[0].OtherIDs[0] = 100
+		if g.Events[0].OtherIDs[0] == 100 {
+			t.Fatalf("events are shared between clones")
+		}
+	})
+}
+
+func TestInvalidActions(t *testing.T) {
+	// 右端の手前にいる Runner が毎ターン場外へ出ようとする
+	invalidGame := func(invalidAction *InvalidActionConfig) Game {
+		return DefaultGameConfig().
+			WithInvalidAction(invalidAction).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(
+						NewAgentConfig("agent-01r", Runner).
+							WithInitPos(geom.NewCoord(49.5, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	step := func(t *testing.T, g *Game) {
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMove(geom.NewPolarVector(1, 0))
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+	}
+
+	t.Run("Validate", func(t *testing.T) {
+		config := DefaultGameConfig().WithInvalidAction(
+			DefaultInvalidActionConfig().WithFreeze(-1),
+		)
+		if err := config.Validate(); err == nil {
+			t.Fatalf("negative freeze accepted")
+		}
+	})
+
+	t.Run("Ignore", func(t *testing.T) {
+		g := invalidGame(DefaultInvalidActionConfig())
+		agent := &g.Agents[0]
+
+		step(t, &g)
+		if !eq(agent.Pos.X, 49.5) || !eq(agent.Point, 0) {
+			t.Fatalf("unexpected agent state: %v, %v", agent.Pos, agent.Point)
+		}
+
+		if agent.Penalty == nil || agent.Penalty.Policy != InvalidIgnore || agent.Violations != 1 {
+			t.Fatalf("penalty is not recorded: %v", agent.Penalty)
+		}
+	})
+
+	t.Run("Clamp", func(t *testing.T) {
+		g := invalidGame(DefaultInvalidActionConfig().WithClamp())
+		agent := &g.Agents[0]
+
+		step(t, &g)
+		if !eq(agent.Pos.X, 50) {
+			t.Fatalf("move is not clamped: %v", agent.Pos)
+		}
+
+		clamped := g.EventsOf(EventMoveClamped)
+		if len(clamped) != 1 || !eq(clamped[0].Value, 0.5) {
+			t.Fatalf("clamped move is not recorded: %v", clamped)
+		}
+
+		if agent.Penalty == nil || agent.Penalty.Policy != InvalidClamp {
+			t.Fatalf("penalty is not recorded: %v", agent.Penalty)
+		}
+	})
+
+	t.Run("PointPenalty", func(t *testing.T) {
+		g := invalidGame(DefaultInvalidActionConfig().WithPointPenalty(2))
+		agent := &g.Agents[0]
+
+		step(t, &g)
+		step(t, &g)
+		if !eq(agent.Point, -4) || !eq(g.Squads[0].TotalPoint, -4) {
+			t.Fatalf("point penalty is not applied: %v", agent.Point)
+		}
+
+		if agent.Violations != 2 {
+			t.Fatalf("unexpected violations: %d", agent.Violations)
+		}
+	})
+
+	t.Run("Freeze", func(t *testing.T) {
+		g := invalidGame(DefaultInvalidActionConfig().WithFreeze(2))
+		agent := &g.Agents[0]
+
+		step(t, &g)
+		if agent.FrozenTurns != 2 {
+			t.Fatalf("agent is not frozen: %d", agent.FrozenTurns)
+		}
+
+		// 凍っている間は (正しい行動であっても) 何もできない
+		for turn := 0; turn < 2; turn++ {
+			g.StartTurn()
+			agent.Action = NewActionMove(geom.NewPolarVector(1, math.Pi))
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+
+			if !eq(agent.Pos.X, 49.5) {
+				t.Fatalf("turn %d: frozen agent moved: %v", turn, agent.Pos)
+			}
+		}
+
+		g.StartTurn()
+		agent.Action = NewActionMove(geom.NewPolarVector(1, math.Pi))
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if !eq(agent.Pos.X, 48.5) {
+			t.Fatalf("agent is still frozen: %v", agent.Pos)
+		}
+	})
+
+	t.Run("Disqualify", func(t *testing.T) {
+		g := dummyGame()
+		g.Config.InvalidAction = *DefaultInvalidActionConfig().WithDisqualify()
+		runner := &g.Agents[1]
+
+		g.StartTurn()
+		runner.Action = NewActionMessage("hi", NewActionMessage("nested", nil))
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if !runner.Disqualified || runner.IsOnField() {
+			t.Fatalf("agent is not disqualified")
+		}
+
+		// 失格となったエージェントは誰からも見えず、得点も動かない
+		point := runner.Point
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if !eq(runner.Point, point) || len(runner.FindWatchingAgents(&g, nil, false)) != 0 {
+			t.Fatalf("disqualified agent still in play")
+		}
+	})
+}
+
+func TestMovement(t *testing.T) {
+	// 原点の東に縦の壁があり、フィールドの東の端の手前にもう一人いる
+	movementGame := func(config *GameConfig, wall *ObstructionConfig) Game {
+		return config.
+			WithFieldConfig(DefaultFieldConfig().WithObstructionAdded(*wall)).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(
+						NewAgentConfig("agent-01h", Hunter).
+							WithInitPos(geom.NewCoord(-0.5, 0)),
+					).
+					WithAgentAdded(
+						NewAgentConfig("agent-01r", Runner).
+							WithInitPos(geom.NewCoord(49.5, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	wall := func() *ObstructionConfig {
+		return NewObstructionConfig(geom.NewSegment(
+			geom.NewCoord(0, -2),
+			geom.NewCoord(0, 2),
+		))
+	}
+
+	diagonal := geom.NewPolarVector(1, math.Pi/4)
+	slid := math.Sqrt(2) / 2
+
+	t.Run("RejectAtEdge", func(t *testing.T) {
+		g := movementGame(DefaultGameConfig(), wall())
+		agent := &g.Agents[1]
+
+		agent.Action = NewActionMove(diagonal)
+		if ok, err := agent.applyActionOn(&g); ok || err == nil {
+			t.Fatalf("move outside of field accepted")
+		}
+	})
+
+	t.Run("RejectedMoveStillTurns", func(t *testing.T) {
+		g := movementGame(DefaultGameConfig(), wall())
+		agent := &g.Agents[1]
+
+		// 移動は拒否されても、回転は (回転の速さの制限の範囲で) 行う
+		agent.Action = NewActionMoveAndTurn(diagonal, math.Pi)
+		if ok, err := agent.applyActionOn(&g); ok || err == nil {
+			t.Fatalf("move outside of field accepted")
+		}
+
+		if !eq(agent.Heading, math.Pi/4) || !eq(agent.Pos.X, 49.5) {
+			t.Fatalf("unexpected state: heading %v, pos %v", agent.Heading, agent.Pos)
+		}
+
+		// ターンを通しても同じ
+		g.StartTurn()
+		g.Agents[1].Action = NewActionMoveAndTurn(diagonal, math.Pi)
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("failed to commit turn: %v", err)
+		}
+
+		if !eq(g.Agents[1].Heading, math.Pi/2) || len(g.EventsOf(EventActionRejected)) != 1 {
+			t.Fatalf(
+				"unexpected state: heading %v, events %v",
+				g.Agents[1].Heading, g.Events,
+			)
+		}
+	})
+
+	t.Run("SlideAlongEdge", func(t *testing.T) {
+		g := movementGame(DefaultGameConfig().WithMovement(MovementSlide), wall())
+		agent := &g.Agents[1]
+
+		agent.Action = NewActionMove(diagonal)
+		if ok, err := agent.applyActionOn(&g); !ok || err != nil {
+			t.Fatalf("slide failed: %v", err)
+		}
+
+		// 東の端にぶつかったあと、残りの北向きの成分だけ滑る
+		if !eq(agent.Pos.X, 50) || !eq(agent.Pos.Y, slid) {
+			t.Fatalf("unexpected position after slide: %v", agent.Pos)
+		}
+
+		// 端に沿って動くのは問題ない
+		agent.Action = NewActionMove(geom.NewPolarVector(1, math.Pi/2))
+		if ok, err := agent.applyActionOn(&g); !ok || err != nil {
+			t.Fatalf("move along edge failed: %v", err)
+		}
+
+		if !eq(agent.Pos.X, 50) || !eq(agent.Pos.Y, slid+1) {
+			t.Fatalf("unexpected position along edge: %v", agent.Pos)
+		}
+	})
+
+	t.Run("PassThroughObstruction", func(t *testing.T) {
+		g := movementGame(DefaultGameConfig(), wall())
+		agent := &g.Agents[0]
+
+		agent.Action = NewActionMove(geom.NewPolarVector(1, 0))
+		if ok, err := agent.applyActionOn(&g); !ok || err != nil {
+			t.Fatalf("move through obstruction failed: %v", err)
+		}
+	})
+
+	t.Run("RejectSolidObstruction", func(t *testing.T) {
+		g := movementGame(DefaultGameConfig(), wall().WithSolid())
+		agent := &g.Agents[0]
+
+		agent.Action = NewActionMove(geom.NewPolarVector(1, 0))
+		if ok, err := agent.applyActionOn(&g); ok || err == nil {
+			t.Fatalf("move through solid obstruction accepted")
+		}
+	})
+
+	t.Run("SlideAlongSolidObstruction", func(t *testing.T) {
+		g := movementGame(
+			DefaultGameConfig().WithMovement(MovementSlide),
+			wall().WithSolid(),
+		)
+		agent := &g.Agents[0]
+
+		agent.Action = NewActionMove(diagonal)
+		if ok, err := agent.applyActionOn(&g); !ok || err != nil {
+			t.Fatalf("slide failed: %v", err)
+		}
+
+		// 壁の手前にとどまったまま北へ滑る
+		if agent.Pos.X >= 0 || math.Abs(agent.Pos.Y-slid) > 1e-5 {
+			t.Fatalf("unexpected position after slide: %v", agent.Pos)
+		}
+
+		// 何度押し付けても壁を抜けることはない
+		for turn := 0; turn < 10; turn++ {
+			agent.Action = NewActionMove(geom.NewPolarVector(1, 0))
+			if _, err := agent.applyActionOn(&g); err != nil {
+				t.Fatalf("turn %d: slide failed: %v", turn, err)
+			}
+
+			if agent.Pos.X >= 0 {
+				t.Fatalf("turn %d: passed through wall: %v", turn, agent.Pos)
+			}
+		}
+	})
+
+	t.Run("OpenDoor", func(t *testing.T) {
+		g := movementGame(DefaultGameConfig(), wall().WithSolid().WithDoor(0, 1, 0))
+		agent := &g.Agents[0]
+
+		agent.Action = NewActionMove(geom.NewPolarVector(1, 0))
+		if ok, err := agent.applyActionOn(&g); !ok || err != nil {
+			t.Fatalf("move through open door failed: %v", err)
+		}
+	})
+}
+
+func TestCollision(t *testing.T) {
+	// 与えられた位置に一人ずつ、別々の Squad の Runner を置く
+	collisionGame := func(config *GameConfig, positions ...geom.Coord) Game {
+		for idx, pos := range positions {
+			config.WithSquadAdded(
+				NewSquadConfig(fmt.Sprintf("squad-%02d", idx+1)).
+					WithAgentAdded(
+						NewAgentConfig(fmt.Sprintf("agent-%02dr", idx+1), Runner).
+							WithInitPos(pos),
+					),
+			)
+		}
+		return config.BuildGame()
+	}
+
+	// 各エージェントに dirs の方向へ 1 だけ動かす (nil ならとどまる)
+	step := func(t *testing.T, g *Game, dirs ...*float64) {
+		g.StartTurn()
+		for idx, dir := range dirs {
+			if dir != nil {
+				g.Agents[idx].Action = NewActionMove(geom.NewPolarVector(1, *dir))
+			}
+		}
+
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+	}
+
+	east, west := 0.0, math.Pi
+
+	t.Run("HeadOn", func(t *testing.T) {
+		g := collisionGame(
+			DefaultGameConfig().WithAgentRadius(0.5, false),
+			geom.NewCoord(-1, 0), geom.NewCoord(1, 0),
+		)
+
+		step(t, &g, &east, &west)
+		if !eq(g.Agents[0].Pos.X, -1) || !eq(g.Agents[1].Pos.X, 1) {
+			t.Fatalf("overlapping moves applied: %v, %v", g.Agents[0].Pos, g.Agents[1].Pos)
+		}
+
+		if collisions := g.EventsOf(EventCollision); len(collisions) != 2 {
+			t.Fatalf("collisions are not recorded: %v", collisions)
+		}
+	})
+
+	t.Run("PassThrough", func(t *testing.T) {
+		// 終わりの位置では重ならないほど速くても、途中ですれ違えない
+		g := collisionGame(
+			DefaultGameConfig().WithAgentRadius(0.3, false),
+			geom.NewCoord(-0.5, 0), geom.NewCoord(0.5, 0),
+		)
+
+		step(t, &g, &east, &west)
+		if !eq(g.Agents[0].Pos.X, -0.5) || !eq(g.Agents[1].Pos.X, 0.5) {
+			t.Fatalf("agents passed through: %v, %v", g.Agents[0].Pos, g.Agents[1].Pos)
+		}
+
+		// 離れていく移動やかすめない移動は妨げない
+		step(t, &g, &west, &east)
+		if !eq(g.Agents[0].Pos.X, -1.5) || !eq(g.Agents[1].Pos.X, 1.5) {
+			t.Fatalf("separating moves are blocked: %v, %v", g.Agents[0].Pos, g.Agents[1].Pos)
+		}
+	})
+
+	t.Run("NoRadius", func(t *testing.T) {
+		g := collisionGame(DefaultGameConfig(), geom.NewCoord(-1, 0), geom.NewCoord(1, 0))
+
+		step(t, &g, &east, &west)
+		if !eq(g.Agents[0].Pos.X, 0) || !eq(g.Agents[1].Pos.X, 0) {
+			t.Fatalf("moves without radius are blocked")
+		}
+	})
+
+	t.Run("Chain", func(t *testing.T) {
+		// 止まっている先頭にぶつかった 2 人目が戻され、その 2 人目にぶつかっ
+		// た 3 人目も戻される
+		positions := []geom.Coord{
+			geom.NewCoord(0, 0), geom.NewCoord(1.5, 0), geom.NewCoord(3, 0),
+		}
+
+		g := collisionGame(DefaultGameConfig().WithAgentRadius(0.6, false), positions...)
+		step(t, &g, nil, &west, &west)
+		for idx, pos := range positions {
+			if !reflect.DeepEqual(g.Agents[idx].Pos, pos) {
+				t.Fatalf("agent %d moved: %v", idx, g.Agents[idx].Pos)
+			}
+		}
+
+		// 順番を逆にしても結果は変わらない
+		g = collisionGame(
+			DefaultGameConfig().WithAgentRadius(0.6, false),
+			positions[2], positions[1], positions[0],
+		)
+		step(t, &g, &west, &west, nil)
+		for idx, pos := range positions {
+			if !reflect.DeepEqual(g.Agents[2-idx].Pos, pos) {
+				t.Fatalf("agent %d moved in reversed order: %v", 2-idx, g.Agents[2-idx].Pos)
+			}
+		}
+	})
+
+	t.Run("Separate", func(t *testing.T) {
+		// 同じ位置から始まっても離れることはできる
+		g := collisionGame(
+			DefaultGameConfig().WithAgentRadius(0.6, false),
+			geom.NewCoord(0, 0), geom.NewCoord(0, 0),
+		)
+
+		step(t, &g, &east, &west)
+		if !eq(g.Agents[0].Pos.X, 1) || !eq(g.Agents[1].Pos.X, -1) {
+			t.Fatalf("agents cannot separate: %v, %v", g.Agents[0].Pos, g.Agents[1].Pos)
+		}
+	})
+
+	t.Run("BodyBlocksSight", func(t *testing.T) {
+		positions := []geom.Coord{
+			geom.NewCoord(-2, 0), geom.NewCoord(0, 0), geom.NewCoord(2, 0),
+		}
+
+		g := collisionGame(DefaultGameConfig().WithAgentRadius(0.5, true), positions...)
+		if g.Agents[0].IsWatching(&g.Agents[2], &g) {
+			t.Fatalf("agent behind body is visible")
+		}
+
+		if !g.Agents[0].IsWatching(&g.Agents[1], &g) {
+			t.Fatalf("blocking agent itself is not visible")
+		}
+
+		g = collisionGame(DefaultGameConfig().WithAgentRadius(0.5, false), positions...)
+		if !g.Agents[0].IsWatching(&g.Agents[2], &g) {
+			t.Fatalf("body blocks sight although disabled")
+		}
+	})
+}
+
+func TestPermutationInvariance(t *testing.T) {
+	type spec struct {
+		name   string
+		squad  string
+		kind   Kind
+		pos    geom.Coord
+		action func() Action
+	}
+
+	specs := []spec{
+		// 正面からぶつかる
+		{"hunter-a", "squad-a", Hunter, geom.NewCoord(-1, 0), func() Action {
+			return NewActionMove(geom.NewPolarVector(1, 0))
+		}},
+		{"runner-b", "squad-b", Runner, geom.NewCoord(1, 0), func() Action {
+			return NewActionMove(geom.NewPolarVector(1, math.Pi))
+		}},
+		// 同じ Squad で帯域を奪い合う
+		{"sender-1", "squad-c", Runner, geom.NewCoord(0, 5), func() Action {
+			return NewActionMessage("hello", nil)
+		}},
+		{"sender-2", "squad-c", Hunter, geom.NewCoord(0, -5), func() Action {
+			return NewActionMessage("yo", NewActionMove(geom.NewPolarVector(1, 0)))
+		}},
+		{"sender-3", "squad-c", Runner, geom.NewCoord(5, 5), func() Action {
+			return NewActionMessage("hi", NewActionHide())
+		}},
+		// 壁に沿って滑る
+		{"sprinter", "squad-a", Runner, geom.NewCoord(49.5, 0), func() Action {
+			return NewActionSprint(geom.NewPolarVector(2, math.Pi/4))
+		}},
+	}
+
+	type outcome struct {
+		Pos     geom.Coord
+		Heading float64
+		Stamina float64
+		Point   float64
+		Outbox  string
+		Inbox   []string
+	}
+
+	run := func(order []int) map[string]outcome {
+		config := DefaultGameConfig().
+			WithAgentRadius(0.5, true).
+			WithMovement(MovementSlide).
+			WithMessageLimits(0, 5, 0)
+
+		squads := map[string]*SquadConfig{}
+		var squadNames []string
+		for _, idx := range order {
+			sp := specs[idx]
+			if _, ok := squads[sp.squad]; !ok {
+				squads[sp.squad] = NewSquadConfig(sp.squad)
+				squadNames = append(squadNames, sp.squad)
+			}
+			squads[sp.squad].WithAgentAdded(
+				NewAgentConfig(sp.name, sp.kind).WithInitPos(sp.pos),
+			)
+		}
+		for _, name := range squadNames {
+			config.WithSquadAdded(squads[name])
+		}
+
+		g := config.BuildGame()
+		for turn := 0; turn < 3; turn++ {
+			g.StartTurn()
+			for idx := range g.Agents {
+				for _, sp := range specs {
+					if sp.name == g.Agents[idx].Name {
+						g.Agents[idx].Action = sp.action()
+					}
+				}
+			}
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+		}
+
+		res := map[string]outcome{}
+		for idx := range g.Agents {
+			agent := &g.Agents[idx]
+			// 送り主の ID や届く順番は並び順で変わるので中身だけを比べる
+			var inbox []string
+			for _, msg := range agent.Inbox {
+				inbox = append(inbox, msg.Payload)
+			}
+			sort.Strings(inbox)
+			res[agent.Name] = outcome{
+				Pos:     agent.Pos,
+				Heading: agent.Heading,
+				Stamina: agent.Stamina,
+				Point:   agent.Point,
+				Outbox:  agent.Outbox,
+				Inbox:   inbox,
+			}
+		}
+		return res
+	}
+
+	identity := []int{0, 1, 2, 3, 4, 5}
+	expected := run(identity)
+
+	// 帯域に収まる短いメッセージだけが通る
+	if expected["sender-1"].Outbox != "" || expected["sender-2"].Outbox != "yo" ||
+		expected["sender-3"].Outbox != "hi" {
+		t.Fatalf("unexpected messages: %+v", expected)
+	}
+
+	for _, order := range permutations(len(specs)) {
+		actual := run(order)
+		for name, want := range expected {
+			got := actual[name]
+			if !reflect.DeepEqual(got.Pos, want.Pos) || !eq(got.Heading, want.Heading) ||
+				!eq(got.Stamina, want.Stamina) || !eq(got.Point, want.Point) ||
+				got.Outbox != want.Outbox || !reflect.DeepEqual(got.Inbox, want.Inbox) {
+				t.Fatalf("order %v: %s differs: %+v vs %+v", order, name, got, want)
+			}
+		}
+	}
+}
+
+func TestKinds(t *testing.T) {
+	// squad-01 の watcher の東に squad-02 の target を置き、その他の
+	// squad-02 のエージェントを others の位置に置く
+	kindGame := func(config *GameConfig, watcher, target Kind, others map[Kind]geom.Coord) Game {
+		squad := NewSquadConfig("squad-02").
+			WithAgentAdded(
+				NewAgentConfig("target", target).WithInitPos(geom.NewCoord(3, 0)),
+			)
+		for kind, pos := range others {
+			squad.WithAgentAdded(NewAgentConfig("other", kind).WithInitPos(pos))
+		}
+
+		return config.
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("watcher", watcher)),
+			).
+			WithSquadAdded(squad).
+			BuildGame()
+	}
+
+	commit := func(t *testing.T, g *Game) {
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		config  *GameConfig
+		watcher Kind
+		target  Kind
+		others  map[Kind]geom.Coord
+		gain    float64
+	}{
+		{"HunterOnRunner", DefaultGameConfig(), Hunter, Runner, nil, 1},
+		{"ScoutDoesNotScore", DefaultGameConfig(), Scout, Runner, nil, 0},
+		{"DecoyIsNegative", DefaultGameConfig(), Hunter, Decoy, nil, -1},
+		{
+			"GuardProtects", DefaultGameConfig(), Hunter, Runner,
+			map[Kind]geom.Coord{Guard: geom.NewCoord(4, 0)}, 0,
+		},
+		{
+			"GuardTooFar", DefaultGameConfig(), Hunter, Runner,
+			map[Kind]geom.Coord{Guard: geom.NewCoord(20, 20)}, 1,
+		},
+		{
+			"CustomRule",
+			DefaultGameConfig().WithKinds(DefaultKindRegistry().WithRule(Scout, Runner, 0.5)),
+			Scout, Runner, nil, 0.5,
+		},
+		{
+			"WithoutRules",
+			DefaultGameConfig().WithKinds(DefaultKindRegistry().WithoutRules()),
+			Hunter, Runner, nil, 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := kindGame(test.config, test.watcher, test.target, test.others)
+			if err := g.Config.Validate(); err != nil {
+				t.Fatalf("invalid config: %v", err)
+			}
+
+			commit(t, &g)
+			if !eq(g.Agents[0].Point, test.gain) || !eq(g.Agents[1].Point, -test.gain) {
+				t.Fatalf(
+					"unexpected points: %v, %v (expected gain %v)",
+					g.Agents[0].Point, g.Agents[1].Point, test.gain,
+				)
+			}
+		})
+	}
+
+	t.Run("UnknownKind", func(t *testing.T) {
+		const medic Kind = 100
+		g := kindGame(DefaultGameConfig(), Hunter, medic, nil)
+		if err := g.Config.Validate(); err == nil {
+			t.Fatalf("unknown kind accepted")
+		}
+
+		registry := DefaultKindRegistry().
+			WithKind(medic, KindInfo{Name: "medic", Symbol: 'm'}).
+			WithRule(Hunter, medic, 2)
+		g = kindGame(DefaultGameConfig().WithKinds(registry), Hunter, medic, nil)
+		if err := g.Config.Validate(); err != nil {
+			t.Fatalf("registered kind rejected: %v", err)
+		}
+
+		commit(t, &g)
+		if !eq(g.Agents[0].Point, 2) {
+			t.Fatalf("custom kind does not score: %v", g.Agents[0].Point)
+		}
+	})
+
+	t.Run("EmptyRegistry", func(t *testing.T) {
+		// ゼロ値の KindRegistry にも追加できる
+		registry := (&KindRegistry{}).WithKind(Hunter, KindInfo{Name: "hunter"})
+		if _, ok := registry.Kinds[Hunter]; !ok {
+			t.Fatalf("kind is not added to zero registry")
+		}
+
+		config := DefaultGameConfig()
+		config.Kinds = KindRegistry{}
+		if err := config.Validate(); err == nil {
+			t.Fatalf("empty kind registry accepted")
+		}
+	})
+
+	t.Run("FindWatchingOnAnyKind", func(t *testing.T) {
+		g := kindGame(DefaultGameConfig(), Hunter, Scout, nil)
+
+		// どの Kind に対して呼んでも panic しない
+		if watching := g.Agents[1].FindWatchingHunters(&g, false); len(watching) != 1 {
+			t.Fatalf("unexpected watching hunters: %v", watching)
+		}
+		if watching := g.Agents[0].FindWatchingRunners(&g, false); len(watching) != 0 {
+			t.Fatalf("unexpected watching runners: %v", watching)
+		}
+	})
+
+	t.Run("CaptureDecoyIsNotPrey", func(t *testing.T) {
+		g := kindGame(
+			DefaultGameConfig().WithCapture(NewCaptureConfig(5, 1)),
+			Hunter, Decoy, nil,
+		)
+
+		commit(t, &g)
+		if g.Agents[1].Captured {
+			t.Fatalf("decoy captured")
+		}
+	})
+}
+
+func TestRoleSwitch(t *testing.T) {
+	commit := func(t *testing.T, g *Game) {
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+	}
+
+	t.Run("Validate", func(t *testing.T) {
+		config := DefaultGameConfig().WithRoleSwitch(NewRoleSwitchConfig().WithInfection())
+		if err := config.Validate(); err == nil {
+			t.Fatalf("infection without capture accepted")
+		}
+	})
+
+	t.Run("Swap", func(t *testing.T) {
+		g := DefaultGameConfig().
+			WithRoleSwitch(NewRoleSwitchConfig().WithSwap(3)).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)).
+					WithAgentAdded(NewAgentConfig("agent-01s", Scout)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(NewAgentConfig("agent-02r", Runner)),
+			).
+			BuildGame()
+
+		if k := g.GetKnowledgeFor(&g.Agents[0]); k.TurnsUntilSwap != 3 {
+			t.Fatalf("unexpected turns until swap: %d", k.TurnsUntilSwap)
+		}
+
+		for turn := 0; turn < 2; turn++ {
+			commit(t, &g)
+			if len(g.EventsOf(EventRoleChange)) != 0 {
+				t.Fatalf("turn %d: swapped too early", turn)
+			}
+		}
+
+		commit(t, &g)
+		if g.Agents[0].Kind != Runner || g.Agents[1].Kind != Scout || g.Agents[2].Kind != Hunter {
+			t.Fatalf(
+				"unexpected kinds: %v, %v, %v",
+				g.Agents[0].Kind, g.Agents[1].Kind, g.Agents[2].Kind,
+			)
+		}
+
+		if changes := g.EventsOf(EventRoleChange); len(changes) != 2 || changes[0].Kind != Runner {
+			t.Fatalf("role changes are not recorded: %v", changes)
+		}
+
+		// 次のターンに考える AI にも伝わる
+		g.StartTurn()
+		k := g.GetKnowledgeFor(&g.Agents[2])
+		expected := []RoleChange{
+			{AgentID: 0, From: Hunter, To: Runner},
+			{AgentID: 2, From: Runner, To: Hunter},
+		}
+		if !reflect.DeepEqual(k.RoleChanges, expected) || k.Me.Kind != Hunter {
+			t.Fatalf("role changes are not in knowledge: %v", k.RoleChanges)
+		}
+
+		if k.TurnsUntilSwap != 3 {
+			t.Fatalf("unexpected turns until next swap: %d", k.TurnsUntilSwap)
+		}
+	})
+
+	t.Run("SwapWhileCaptured", func(t *testing.T) {
+		// 捕まっている間に Hunter になっても、予定どおりに復帰する
+		g := DefaultGameConfig().
+			WithCapture(NewCaptureConfig(4, 1).WithRespawn(3)).
+			WithRoleSwitch(NewRoleSwitchConfig().WithSwap(2)).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).WithInitPos(geom.NewCoord(3, 0)),
+					),
+			).
+			BuildGame()
+		runner := &g.Agents[1]
+
+		commit(t, &g)
+		if !runner.Captured {
+			t.Fatalf("runner is not captured")
+		}
+
+		for turn := 1; turn < 3; turn++ {
+			commit(t, &g)
+			if !runner.Captured {
+				t.Fatalf("turn %d: respawned too early", turn)
+			}
+		}
+
+		if runner.Kind != Hunter {
+			t.Fatalf("captured runner is not swapped: %v", runner.Kind)
+		}
+
+		commit(t, &g)
+		if runner.Captured || runner.RespawnIn != 0 {
+			t.Fatalf("swapped agent did not respawn: %d turns left", runner.RespawnIn)
+		}
+
+		if len(g.EventsOf(EventRespawn)) != 1 {
+			t.Fatalf("respawn is not recorded: %v", g.Events)
+		}
+	})
+
+	t.Run("Infection", func(t *testing.T) {
+		// 原点の Hunter からは近くの Runner しか捕まえられない
+		g := DefaultGameConfig().
+			WithCapture(NewCaptureConfig(4, 1)).
+			WithRoleSwitch(NewRoleSwitchConfig().WithInfection()).
+			WithEndConditions(NewEndConditions().WithAllRunnersCaptured()).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("near", Runner).WithInitPos(geom.NewCoord(3, 0)),
+					),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-03").
+					WithAgentAdded(
+						NewAgentConfig("far", Runner).WithInitPos(geom.NewCoord(6, 0)),
+					),
+			).
+			BuildGame()
+		near, far := &g.Agents[1], &g.Agents[2]
+
+		// 同じターンに感染した Hunter はまだ捕まえられない
+		commit(t, &g)
+		if near.Kind != Hunter || near.Captured || far.Kind != Runner {
+			t.Fatalf("unexpected kinds: %v, %v", near.Kind, far.Kind)
+		}
+
+		if g.IsFinished() {
+			t.Fatalf("finished while runner remains")
+		}
+
+		commit(t, &g)
+		if far.Kind != Hunter {
+			t.Fatalf("runner is not infected: %v", far.Kind)
+		}
+
+		if g.Result == nil || g.Result.Reason != EndReasonAllRunnersCaptured {
+			t.Fatalf("game did not end after all runners infected: %+v", g.Result)
+		}
+	})
+}
+
+func TestSpawn(t *testing.T) {
+	west := geom.NewRectFromPoints(-40, -40, -30, -30)
+	east := geom.NewRectFromPoints(30, 30, 40, 40)
+
+	// 各 Squad に Hunter 一人と Runner 二人を置く
+	spawnGame := func(config *GameConfig, field *FieldConfig) Game {
+		config.WithFieldConfig(field)
+		for _, name := range []string{"squad-01", "squad-02"} {
+			config.WithSquadAdded(
+				NewSquadConfig(name).
+					WithAgentAdded(NewAgentConfig(name+"h", Hunter)).
+					WithAgentAdded(NewAgentConfig(name+"r1", Runner)).
+					WithAgentAdded(NewAgentConfig(name+"r2", Runner)),
+			)
+		}
+		return config.BuildGame()
+	}
+
+	squadZones := func() *FieldConfig {
+		return DefaultFieldConfig().
+			WithSpawnZoneAdded(NewSpawnZoneConfig(west).ForSquad("squad-01")).
+			WithSpawnZoneAdded(NewSpawnZoneConfig(east).ForSquad("squad-02")).
+			WithMinSpawnSeparation(2)
+	}
+
+	t.Run("Validate", func(t *testing.T) {
+		config := DefaultGameConfig().WithFieldConfig(
+			DefaultFieldConfig().WithSpawnZoneAdded(
+				NewSpawnZoneConfig(geom.NewRectFromPoints(40, 40, 60, 60)),
+			),
+		)
+		if err := config.Validate(); err == nil {
+			t.Fatalf("spawn zone outside of field accepted")
+		}
+	})
+
+	t.Run("SquadZones", func(t *testing.T) {
+		g := spawnGame(DefaultGameConfig(), squadZones())
+
+		for idx := range g.Agents {
+			agent := &g.Agents[idx]
+			zone := west
+			if agent.SquadID == 1 {
+				zone = east
+			}
+
+			if !zone.Contains(agent.Pos) {
+				t.Fatalf("agent %d is outside of its zone: %v", idx, agent.Pos)
+			}
+
+			for other := 0; other < idx; other++ {
+				if dist := g.Agents[other].Pos.DistanceTo(agent.Pos); dist < 2 {
+					t.Fatalf("agents %d and %d are too close: %v", other, idx, dist)
+				}
+			}
+		}
+	})
+
+	t.Run("Rotated", func(t *testing.T) {
+		config := DefaultGameConfig()
+		spawnGame(config, squadZones())
+		g := config.WithSpawnZonesRotated(1).BuildGame()
+
+		for idx := range g.Agents {
+			agent := &g.Agents[idx]
+			zone := east
+			if agent.SquadID == 1 {
+				zone = west
+			}
+
+			if !zone.Contains(agent.Pos) {
+				t.Fatalf("agent %d is outside of rotated zone: %v", idx, agent.Pos)
+			}
+		}
+
+		// 一周すると元に戻る
+		config.WithSpawnZonesRotated(1)
+		if squad := config.Field.SpawnZones[0].Squad; squad != "squad-01" {
+			t.Fatalf("zones are not restored: %s", squad)
+		}
+
+		// 負の数だけ逆に入れ替える
+		config.WithSpawnZonesRotated(-3)
+		if squad := config.Field.SpawnZones[0].Squad; squad != "squad-02" {
+			t.Fatalf("zones are not rotated backwards: %s", squad)
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		positions := func(seed int64) (res []geom.Coord) {
+			g := spawnGame(DefaultGameConfig().WithSeed(seed), squadZones())
+			for idx := range g.Agents {
+				res = append(res, g.Agents[idx].Pos)
+			}
+			return
+		}
+
+		if !reflect.DeepEqual(positions(1), positions(1)) {
+			t.Fatalf("placement is not deterministic")
+		}
+
+		if reflect.DeepEqual(positions(1), positions(2)) {
+			t.Fatalf("placement does not depend on seed")
+		}
+	})
+
+	t.Run("KindZone", func(t *testing.T) {
+		g := spawnGame(
+			DefaultGameConfig(),
+			DefaultFieldConfig().
+				WithSpawnZoneAdded(NewSpawnZoneConfig(east).ForKind(Hunter)).
+				WithSpawnZoneAdded(NewSpawnZoneConfig(west)),
+		)
+
+		for idx := range g.Agents {
+			agent := &g.Agents[idx]
+			zone := west
+			if agent.Kind == Hunter {
+				zone = east
+			}
+
+			if !zone.Contains(agent.Pos) {
+				t.Fatalf("agent %d is outside of its zone: %v", idx, agent.Pos)
+			}
+		}
+	})
+
+	t.Run("FixedInitPos", func(t *testing.T) {
+		g := DefaultGameConfig().
+			WithFieldConfig(
+				DefaultFieldConfig().WithSpawnZoneAdded(NewSpawnZoneConfig(west)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(
+						NewAgentConfig("fixed", Hunter).WithInitPos(geom.NewCoord(1, 2)),
+					).
+					WithAgentAdded(NewAgentConfig("random", Runner)),
+			).
+			BuildGame()
+
+		if !reflect.DeepEqual(g.Agents[0].Pos, geom.NewCoord(1, 2)) {
+			t.Fatalf("fixed position is ignored: %v", g.Agents[0].Pos)
+		}
+
+		if !west.Contains(g.Agents[1].Pos) {
+			t.Fatalf("agent is not placed in zone: %v", g.Agents[1].Pos)
+		}
+	})
+
+	t.Run("FixedWithLaterID", func(t *testing.T) {
+		// 位置の決まった、後の ID のエージェントからも離して置く
+		fixedPos := geom.NewCoord(-35, -35)
+		g := DefaultGameConfig().
+			WithFieldConfig(
+				DefaultFieldConfig().
+					WithSpawnZoneAdded(NewSpawnZoneConfig(
+						geom.NewRectFromPoints(-37, -37, -33, -33),
+					)).
+					WithMinSpawnSeparation(2),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("random", Runner)).
+					WithAgentAdded(NewAgentConfig("fixed", Hunter).WithInitPos(fixedPos)),
+			).
+			BuildGame()
+
+		if dist := g.Agents[0].Pos.DistanceTo(fixedPos); dist < 2 {
+			t.Fatalf("agent is placed too close to fixed agent: %v", dist)
+		}
+	})
+
+	t.Run("Infeasible", func(t *testing.T) {
+		zone := geom.NewRectFromPoints(-1, -1, 1, 1)
+		configs := map[string]*GameConfig{
+			"NoGo": DefaultGameConfig().WithFieldConfig(
+				DefaultFieldConfig().
+					WithAreaAdded(NewAreaConfig(
+						geom.NewPolygonFromRect(geom.NewRectFromPoints(-2, -2, 2, 2)),
+					).WithNoGo()).
+					WithSpawnZoneAdded(NewSpawnZoneConfig(zone)),
+			),
+			"Separation": DefaultGameConfig().WithFieldConfig(
+				DefaultFieldConfig().
+					WithSpawnZoneAdded(NewSpawnZoneConfig(zone)).
+					WithMinSpawnSeparation(10),
+			),
+		}
+
+		for name, config := range configs {
+			config.WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)).
+					WithAgentAdded(NewAgentConfig("agent-01r", Runner)),
+			)
+
+			if err := config.Validate(); err == nil {
+				t.Errorf("%s: infeasible spawn zone accepted", name)
+			}
+		}
+	})
+
+	t.Run("AvoidObstructions", func(t *testing.T) {
+		wall := NewObstructionConfig(geom.NewSegment(
+			geom.NewCoord(0, -5),
+			geom.NewCoord(0, 5),
+		))
+		g := spawnGame(
+			DefaultGameConfig().WithAgentRadius(0.5, false),
+			DefaultFieldConfig().
+				WithObstructionAdded(*wall).
+				WithSpawnZoneAdded(
+					NewSpawnZoneConfig(geom.NewRectFromPoints(-1, -1, 1, 1)),
+				),
+		)
+
+		for idx := range g.Agents {
+			if x := g.Agents[idx].Pos.X; math.Abs(x) < 0.5 {
+				t.Fatalf("agent %d is placed on obstruction: %v", idx, g.Agents[idx].Pos)
+			}
+		}
+	})
+
+	t.Run("Respawn", func(t *testing.T) {
+		g := DefaultGameConfig().
+			WithCapture(NewCaptureConfig(5, 1).WithRespawn(0)).
+			WithFieldConfig(
+				DefaultFieldConfig().WithSpawnZoneAdded(
+					NewSpawnZoneConfig(east).ForSquad("squad-02"),
+				),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(NewAgentConfig("agent-02r", Runner)),
+			).
+			BuildGame()
+		runner := &g.Agents[1]
+
+		// 捕まえられるように Hunter の隣へ連れてくる
+		g.StartTurn()
+		runner.Pos = geom.NewCoord(1, 0)
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if len(g.EventsOf(EventRespawn)) != 1 || !east.Contains(runner.Pos) {
+			t.Fatalf("runner did not respawn in zone: %v", runner.Pos)
+		}
+	})
+}
+
+func TestMessages(t *testing.T) {
+	// squad-01 に 3 人、squad-02 に 1 人いるゲームを作る。
+	// agent-01c だけは遠くにいる。
+	messageGame := func(config *GameConfig) Game {
+		return config.
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01a", Hunter)).
+					WithAgentAdded(NewAgentConfig("agent-01b", Runner)).
+					WithAgentAdded(
+						NewAgentConfig("agent-01c", Runner).
+							WithInitPos(geom.NewCoord(40, 0)),
+					),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(NewAgentConfig("agent-02a", Hunter)),
+			).
+			BuildGame()
+	}
+
+	t.Run("DeliveredToSquadNextTurn", func(t *testing.T) {
+		g := messageGame(DefaultGameConfig())
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMessage(
+			"hello",
+			NewActionMove(geom.NewPolarVector(1, 0)),
+		)
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		// メッセージと一緒に移動もしている
+		if !eq(g.Agents[0].Pos.X, 1.0) {
+			t.Fatalf("inner action is not applied: %v", g.Agents[0].Pos)
 		}
 
-		// 実際にはスピード程度に抑えられていることを確認する
-		expected := geom.NewCoord(1, 0)
-		actual := agent.Pos
-		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
-			t.Fatalf("expected %v but actual %v", expected, actual)
+		g.StartTurn()
+		asserts := []struct {
+			id          int
+			numMessages int
+		}{
+			{0, 0},
+			{1, 1},
+			{2, 1},
+			{3, 0},
 		}
-	})
 
-	t.Run("InvalidAgent", func(t *testing.T) {
-		g := dummyGame()
-		agent := Agent{
-			ID:         0,
-			InSquadID:  0,
-			SquadID:    0,
-			Name:       "",
-			Kind:       0,
-			Pos:        geom.NewCoord(0, 0),
-			Point:      0,
-			PointGains: []PointGain{},
-			Action:     &ActionMove{Dir: geom.NewPolarVector(1, 0)},
-		}
+		for _, assert := range asserts {
+			knowledge := g.GetKnowledgeFor(&g.Agents[assert.id])
+			if len(knowledge.Messages) != assert.numMessages {
+				t.Fatalf(
+					"agent %s received %v",
+					g.DescribeAgent(&g.Agents[assert.id]), knowledge.Messages,
+				)
+			}
 
-		ok, err := agent.applyActionOn(&g)
+			for _, message := range knowledge.Messages {
+				if message.AgentIDSentFrom != 0 || message.Payload != "hello" {
+					t.Fatalf("unexpected message: %v", message)
+				}
+			}
+		}
 
-		if err == nil {
-			t.Fatalf("invalid agent accepted")
+		// 他の Squad からは中身が見えない
+		for _, watcher := range g.GetKnowledgeFor(&g.Agents[3]).Watchers {
+			if len(watcher.Inbox) != 0 {
+				t.Fatalf("enemy inbox is visible: %v", watcher.Inbox)
+			}
 		}
 
-		if ok {
-			t.Fatalf("error but returned true")
+		// さらに次のターンには消えている
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+		if len(g.Agents[1].Inbox) != 0 {
+			t.Fatalf("message is not cleared: %v", g.Agents[1].Inbox)
 		}
 	})
 
-	t.Run("RunSpecifiedTime", func(t *testing.T) {
-		count := 0
+	t.Run("HiddenInAction", func(t *testing.T) {
+		// 同じターンの行動からも、遅れて報告される過去の状態からも読めては
+		// いけない
+		for _, delay := range []int{0, 1} {
+			config := DefaultGameConfig().
+				WithSharedVision(true).
+				WithObservation(DefaultObservationConfig().WithDelay(delay))
+			g := messageGame(config)
+
+			assertHidden := func(turn int) {
+				knowledge := g.GetKnowledgeFor(&g.Agents[3])
+				views := append([]Agent{}, knowledge.Watchers...)
+				for _, sighting := range knowledge.Sightings {
+					views = append(views, sighting.Agent)
+				}
 
-		g := dummyGame()
-		for !g.IsFinished() {
-			if count > g.Config.Time {
-				t.Fatalf(
-					"Turn elapsed without stopping game (%d turns (in %d turns) left)",
-					g.TimeRemaining,
-					g.Config.Time,
-				)
-			}
-			g.StartTurn()
-			g.Agents[0].Action = &ActionMove{
-				Dir: geom.NewPolarVector(0.01, 0),
-			}
+				if len(views) == 0 {
+					t.Fatalf("delay %d, turn %d: no agent is visible", delay, turn)
+				}
 
-			if err := g.CommitTurn(); err != nil {
-				t.Fatalf("commit turn failed: %v", err)
+				for _, view := range views {
+					if view.ID != 3 && view.Action != nil {
+						t.Fatalf(
+							"delay %d, turn %d: action of %s is visible: %v",
+							delay, turn, g.DescribeAgent(&g.Agents[view.ID]), view.Action,
+						)
+					}
+				}
 			}
 
-			count++
+			for turn := 0; turn < 2; turn++ {
+				// 先に行動を決めた Agent のメッセージが、後から決める Agent
+				// に見えてはいけない
+				g.StartTurn()
+				g.Agents[0].Action = NewActionMessage("secret", nil)
+				assertHidden(turn)
+
+				if err := g.CommitTurn(); err != nil {
+					t.Fatalf("commit turn failed: %v", err)
+				}
+				assertHidden(turn)
+			}
 		}
+	})
 
-		expected := geom.NewCoord(1, 0)
-		actual := g.Agents[0].Pos
-		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
-			t.Fatalf("expected %v but actual %v", expected, actual)
+	t.Run("Range", func(t *testing.T) {
+		g := messageGame(DefaultGameConfig().WithMessageLimits(256, 0, 10))
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMessage("hello", nil)
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
 		}
 
-		if count != g.Config.Time {
-			t.Fatalf("Only %d turn (in %d turn) passed", count, g.Config.Time)
+		if len(g.Agents[1].Inbox) != 1 {
+			t.Fatalf("near mate did not receive: %v", g.Agents[1].Inbox)
 		}
 
-		if !g.IsFinished() {
-			t.Fatalf("IsFinished() is inconsistent")
+		if len(g.Agents[2].Inbox) != 0 {
+			t.Fatalf("far mate received: %v", g.Agents[2].Inbox)
 		}
 	})
 
-	t.Run("RunSpecifiedTimeErrornous", func(t *testing.T) {
-		count := 0
-
-		g := dummyGame()
-		for !g.IsFinished() {
-			if count > g.Config.Time {
-				t.Fatalf(
-					"Turn elapsed without stopping game (%d turns (in %d turns) left)",
-					g.TimeRemaining,
-					g.Config.Time,
-				)
-			}
-			g.StartTurn()
-			tooFastSpeed := g.Config.Field.Rect.RB.X * 2 /
-				float64(g.Config.Time)
-			g.Agents[0].Action = &ActionMove{
-				Dir: geom.NewPolarVector(tooFastSpeed, 0),
-			}
-
-			if err := g.CommitTurn(); err != nil {
-				t.Fatalf("commit turn failed: %v", err)
-			}
+	t.Run("TooLong", func(t *testing.T) {
+		g := messageGame(DefaultGameConfig().WithMessageLimits(4, 0, 0))
+		agent := &g.Agents[0]
 
-			count++
+		agent.Action = NewActionMessage("hello", nil)
+		ok, err := agent.applyActionOn(&g)
+		if err == nil {
+			t.Fatalf("too long message accepted")
 		}
 
-		expected := geom.NewCoord(g.Config.Field.Rect.RB.X, 0)
-		actual := g.Agents[0].Pos
-		if !eq(actual.X, expected.X) || !eq(actual.Y, expected.Y) {
-			t.Fatalf("expected %v but actual %v", expected, actual)
+		if ok {
+			t.Fatalf("error but returned true")
 		}
+	})
 
-		if count != g.Config.Time {
-			t.Fatalf("Only %d turn (in %d turn) passed", count, g.Config.Time)
+	t.Run("Bandwidth", func(t *testing.T) {
+		g := messageGame(DefaultGameConfig().WithMessageLimits(0, 8, 0))
+
+		g.StartTurn()
+		g.Agents[0].Action = NewActionMessage("hello", nil)
+		g.Agents[1].Action = NewActionMessage("world", nil)
+		g.processActions()
+		rejected := g.EventsOf(EventActionRejected)
+		if len(rejected) != 1 || rejected[0].AgentID != 1 {
+			t.Fatalf("bandwidth exceeding message accepted: %v", rejected)
 		}
 
-		if !g.IsFinished() {
-			t.Fatalf("IsFinished() is inconsistent")
+		if g.Squads[0].MessageBytes != 5 {
+			t.Fatalf("unexpected bandwidth usage: %d", g.Squads[0].MessageBytes)
 		}
 	})
 }
@@ -520,6 +2952,290 @@ func TestTurn(t *testing.T) {
 	})
 }
 
+func TestKnowledge(t *testing.T) {
+	t.Run("TimeAndScores", func(t *testing.T) {
+		g := obstructedGame(DefaultGameConfig())
+
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+		g.StartTurn()
+
+		hunter1 := &g.Agents[0]
+		knowledge := g.GetKnowledgeFor(hunter1)
+
+		if knowledge.TimeRemaining != g.Config.Time-1 {
+			t.Fatalf("unexpected time remaining: %d", knowledge.TimeRemaining)
+		}
+
+		if !eq(knowledge.SquadPoint, 1.0) {
+			t.Fatalf("unexpected squad point: %v", knowledge.SquadPoint)
+		}
+
+		if !reflect.DeepEqual(knowledge.Scores, []float64{1.0, -1.0}) {
+			t.Fatalf("unexpected scores: %v", knowledge.Scores)
+		}
+
+		// 前のターンに runner2 から得点を得ている
+		expected := []PointGain{{AgentIDGainedFrom: 3, Gain: 1.0}}
+		if !reflect.DeepEqual(knowledge.LastPointGains, expected) {
+			t.Fatalf("unexpected last point gains: %v", knowledge.LastPointGains)
+		}
+	})
+
+	t.Run("PrivateScores", func(t *testing.T) {
+		g := obstructedGame(DefaultGameConfig().WithPublicScores(false))
+
+		if scores := g.GetKnowledgeFor(&g.Agents[0]).Scores; scores != nil {
+			t.Fatalf("scores are public: %v", scores)
+		}
+	})
+
+	t.Run("LastSeen", func(t *testing.T) {
+		g := obstructedGame(DefaultGameConfig())
+		hunter1 := &g.Agents[0]
+		runner2 := &g.Agents[3]
+
+		// runner2 は壁の線上を経由して壁の向こうへ移動する
+		for turn := 0; turn < 2; turn++ {
+			g.StartTurn()
+			runner2.Action = NewActionMove(geom.NewPolarVector(1, 0))
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+		}
+
+		if hunter1.IsWatching(runner2, &g) {
+			t.Fatalf("runner2 is still visible")
+		}
+
+		knowledge := g.GetKnowledgeFor(hunter1)
+		var found *LastSeen
+		for idx := range knowledge.LastSeen {
+			if knowledge.LastSeen[idx].AgentID == runner2.ID {
+				found = &knowledge.LastSeen[idx]
+			}
+		}
+
+		if found == nil {
+			t.Fatalf("runner2 is not remembered: %v", knowledge.LastSeen)
+		}
+
+		if !eq(found.Pos.X, 0) || !eq(found.Pos.Y, -1) || found.Turn != 1 {
+			t.Fatalf("unexpected last seen: %v", *found)
+		}
+
+		// 一度も見ていない runner1 は記憶にない
+		for _, seen := range knowledge.LastSeen {
+			if seen.AgentID == 1 {
+				t.Fatalf("runner1 is remembered: %v", seen)
+			}
+		}
+	})
+}
+
+func TestObservation(t *testing.T) {
+	// squad-01 の二人と、距離 10 だけ離れた squad-02 の一人
+	observationGame := func(config *GameConfig) Game {
+		return config.
+			WithSquadAdded(
+				NewSquadConfig("squad-01").
+					WithAgentAdded(NewAgentConfig("agent-01h", Hunter)).
+					WithAgentAdded(
+						NewAgentConfig("agent-01r", Runner).
+							WithInitPos(geom.NewCoord(0, 10)),
+					),
+			).
+			WithSquadAdded(
+				NewSquadConfig("squad-02").
+					WithAgentAdded(
+						NewAgentConfig("agent-02r", Runner).
+							WithInitPos(geom.NewCoord(10, 0)),
+					),
+			).
+			BuildGame()
+	}
+
+	findWatcher := func(knowledge Knowledge, id int) *Agent {
+		for idx := range knowledge.Watchers {
+			if knowledge.Watchers[idx].ID == id {
+				return &knowledge.Watchers[idx]
+			}
+		}
+		return nil
+	}
+
+	t.Run("Exact", func(t *testing.T) {
+		g := observationGame(DefaultGameConfig())
+
+		enemy := findWatcher(g.GetKnowledgeFor(&g.Agents[0]), 2)
+		if enemy == nil || !eq(enemy.Pos.X, 10) || !eq(enemy.Pos.Y, 0) {
+			t.Fatalf("enemy position is not exact: %v", enemy)
+		}
+	})
+
+	t.Run("Noise", func(t *testing.T) {
+		config := DefaultGameConfig().
+			WithObservation(DefaultObservationConfig().WithNoise(0.1))
+		g := observationGame(config)
+
+		knowledge := g.GetKnowledgeFor(&g.Agents[0])
+		enemy := findWatcher(knowledge, 2)
+		if enemy == nil {
+			t.Fatalf("enemy is not observed")
+		}
+
+		if eq(enemy.Pos.X, 10) && eq(enemy.Pos.Y, 0) {
+			t.Fatalf("enemy position is exact even with noise")
+		}
+
+		// 仲間の位置は正確
+		mate := findWatcher(knowledge, 1)
+		if mate == nil || !eq(mate.Pos.X, 0) || !eq(mate.Pos.Y, 10) {
+			t.Fatalf("mate position is not exact: %v", mate)
+		}
+
+		// 同じ種であれば同じ観測になる
+		same := observationGame(config)
+		again := findWatcher(same.GetKnowledgeFor(&same.Agents[0]), 2)
+		if !reflect.DeepEqual(enemy.Pos, again.Pos) {
+			t.Fatalf("observation is not reproducible: %v vs %v", enemy.Pos, again.Pos)
+		}
+
+		// 違う種なら違う観測になる
+		other := observationGame(config.WithSeed(42))
+		otherEnemy := findWatcher(other.GetKnowledgeFor(&other.Agents[0]), 2)
+		if reflect.DeepEqual(enemy.Pos, otherEnemy.Pos) {
+			t.Fatalf("observation does not depend on seed: %v", enemy.Pos)
+		}
+	})
+
+	t.Run("Detection", func(t *testing.T) {
+		config := DefaultGameConfig().
+			WithObservation(DefaultObservationConfig().WithDetection(1.0, 0.1))
+		g := observationGame(config)
+
+		// 距離 10 では検出できる確率が 0 になる
+		knowledge := g.GetKnowledgeFor(&g.Agents[0])
+		if findWatcher(knowledge, 2) != nil {
+			t.Fatalf("far enemy is detected")
+		}
+
+		if findWatcher(knowledge, 1) == nil {
+			t.Fatalf("mate is not detected")
+		}
+
+		// 得点の計算には影響しない
+		g.StartTurn()
+		if err := g.CommitTurn(); err != nil {
+			t.Fatalf("commit turn failed: %v", err)
+		}
+
+		if !eq(g.Agents[0].Point, 1.0) {
+			t.Fatalf("undetected runner did not provide point")
+		}
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		config := DefaultGameConfig().
+			WithObservation(DefaultObservationConfig().WithDelay(2))
+		g := observationGame(config)
+
+		// 位置だけでなく向きも同じターンのものが報告される
+		expectedX := []float64{10, 10, 10, 11, 12}
+		expectedHeading := []float64{0, 0, 0, 0.1, 0.2}
+		for turn, x := range expectedX {
+			enemy := findWatcher(g.GetKnowledgeFor(&g.Agents[0]), 2)
+			if enemy == nil || !eq(enemy.Pos.X, x) {
+				t.Fatalf("turn %d: expected x %v but %v", turn, x, enemy)
+			}
+
+			if !eq(enemy.Heading, expectedHeading[turn]) {
+				t.Fatalf(
+					"turn %d: expected heading %v but %v",
+					turn, expectedHeading[turn], enemy.Heading,
+				)
+			}
+
+			if len(enemy.History) != 0 {
+				t.Fatalf("turn %d: history of enemy is visible", turn)
+			}
+
+			g.StartTurn()
+			g.Agents[2].Action = NewActionMoveAndTurn(geom.NewPolarVector(1, 0), 0.1)
+			if err := g.CommitTurn(); err != nil {
+				t.Fatalf("commit turn failed: %v", err)
+			}
+		}
+	})
+}
+
+func TestSharedVision(t *testing.T) {
+	t.Run("Individual", func(t *testing.T) {
+		g := obstructedGame(DefaultGameConfig())
+
+		// *r は壁の向こうにいるので自分しか見えない
+		runner1 := &g.Agents[1]
+		knowledge := g.GetKnowledgeFor(runner1)
+		if len(knowledge.Sightings) != 1 {
+			t.Fatalf("unexpected sightings: %v", knowledge.Sightings)
+		}
+
+		sighting := knowledge.Sightings[0]
+		if sighting.Agent.ID != runner1.ID ||
+			!reflect.DeepEqual(sighting.ObserverIDs, []int{runner1.ID}) {
+			t.Fatalf("unexpected sighting: %v", sighting)
+		}
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		g := obstructedGame(DefaultGameConfig().WithSharedVision(true))
+
+		// *r は *h が見ているものも分かる
+		runner1 := &g.Agents[1]
+		knowledge := g.GetKnowledgeFor(runner1)
+
+		expected := [][]int{{0}, {1}, {0}, {0}}
+		if len(knowledge.Sightings) != len(expected) {
+			t.Fatalf("unexpected sightings: %v", knowledge.Sightings)
+		}
+
+		for idx, sighting := range knowledge.Sightings {
+			if sighting.Agent.ID != idx ||
+				!reflect.DeepEqual(sighting.ObserverIDs, expected[idx]) {
+				t.Fatalf(
+					"unexpected sighting of agent %d: %v",
+					idx, sighting,
+				)
+			}
+		}
+
+		// Watchers は自分から見えるものだけのまま
+		if len(knowledge.Watchers) != 1 {
+			t.Fatalf("unexpected watchers: %v", knowledge.Watchers)
+		}
+	})
+}
+
+// 0, 1, ..., n-1 の並べ替えをすべて返す
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+
+	var res [][]int
+	for _, perm := range permutations(n - 1) {
+		for pos := 0; pos <= len(perm); pos++ {
+			next := append([]int{}, perm[:pos]...)
+			next = append(next, n-1)
+			next = append(next, perm[pos:]...)
+			res = append(res, next)
+		}
+	}
+	return res
+}
+
 func eq(a, b float64) bool {
 	return math.Abs(a-b) < 1e-8
 }
@@ -538,3 +3254,50 @@ func dummyGame() Game {
 	}
 	return config.BuildGame()
 }
+
+// 次のような位置関係のゲームを作る。
+//
+//	+h |
+//	*h | *r
+//	+r |
+//
+// *: squad-01
+// +: squad-02
+func obstructedGame(config *GameConfig) Game {
+	return config.
+		WithSquadAdded(
+			NewSquadConfig("squad-01").
+				WithAgentAdded(
+					NewAgentConfig("agent-01h", Hunter).
+						WithInitPos(geom.NewCoord(-1, 0)),
+				).
+				WithAgentAdded(
+					NewAgentConfig("agent-01r", Runner).
+						WithInitPos(geom.NewCoord(1, 0)),
+				),
+		).
+		WithSquadAdded(
+			NewSquadConfig("squad-02").
+				WithAgentAdded(
+					NewAgentConfig("agent-02h", Hunter).
+						WithInitPos(geom.NewCoord(-1, 1)),
+				).
+				WithAgentAdded(
+					NewAgentConfig("agent-02r", Runner).
+						WithInitPos(geom.NewCoord(-1, -1)),
+				),
+		).
+		// 中央の遮蔽物を追加する
+		WithFieldConfig(
+			DefaultFieldConfig().
+				WithObstructionAdded(
+					ObstructionConfig{
+						Segment: geom.NewSegment(
+							geom.NewCoord(0, 2),
+							geom.NewCoord(0, -2),
+						),
+					},
+				),
+		).
+		BuildGame()
+}
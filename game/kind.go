@@ -0,0 +1,179 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Kind int
+
+const (
+	// Runner を見つけて得点を奪う
+	Hunter Kind = iota
+	// Hunter から逃げる
+	Runner
+	// 見ることはできるが得点はしない (SharedVision で仲間に情報を伝える)
+	Scout
+	// 近くにいる仲間が見られても得点を奪われないように守る
+	Guard
+	// 見つけた Hunter が逆に得点を失うおとり
+	Decoy
+)
+
+// Kind ごとの性質。
+type KindInfo struct {
+	Name string
+	// 表示に使う 1 文字
+	Symbol rune
+	// GuardRange 以内にいる同じ Squad の仲間は、見られても得点を奪われない。
+	// 0 なら守らない。
+	GuardRange float64
+}
+
+// Watcher が他の Squad の Target を見ているとき、Target の Squad から
+// Watcher の Squad へ毎ターン Point だけ得点が移る (負なら逆向き)。同じ
+// Target を複数の Watcher が見ている場合は Watcher で等分する。
+type ScoreRule struct {
+	Watcher Kind
+	Target  Kind
+	Point   float64
+}
+
+// どのような Kind があり、どの Kind がどの Kind から得点するか。
+type KindRegistry struct {
+	Kinds map[Kind]KindInfo
+	Rules []ScoreRule
+}
+
+func DefaultKindRegistry() *KindRegistry {
+	return &KindRegistry{
+		Kinds: map[Kind]KindInfo{
+			Hunter: {Name: "hunter", Symbol: 'h'},
+			Runner: {Name: "runner", Symbol: 'r'},
+			Scout:  {Name: "scout", Symbol: 's'},
+			Guard:  {Name: "guard", Symbol: 'g', GuardRange: 3},
+			Decoy:  {Name: "decoy", Symbol: 'd'},
+		},
+		Rules: []ScoreRule{
+			{Watcher: Hunter, Target: Runner, Point: 1},
+			{Watcher: Hunter, Target: Decoy, Point: -1},
+		},
+	}
+}
+
+// kind を追加する。すでにあれば置き換える。
+func (r *KindRegistry) WithKind(kind Kind, info KindInfo) *KindRegistry {
+	if r.Kinds == nil {
+		r.Kinds = map[Kind]KindInfo{}
+	}
+	r.Kinds[kind] = info
+	return r
+}
+
+func (r *KindRegistry) WithRule(watcher, target Kind, point float64) *KindRegistry {
+	r.Rules = append(r.Rules, ScoreRule{
+		Watcher: watcher,
+		Target:  target,
+		Point:   point,
+	})
+	return r
+}
+
+// 得点の規則をすべて取り除く。
+func (r *KindRegistry) WithoutRules() *KindRegistry {
+	r.Rules = []ScoreRule{}
+	return r
+}
+
+func (r *KindRegistry) Clone() KindRegistry {
+	kinds := make(map[Kind]KindInfo, len(r.Kinds))
+	for kind, info := range r.Kinds {
+		kinds[kind] = info
+	}
+
+	return KindRegistry{
+		Kinds: kinds,
+		Rules: append([]ScoreRule{}, r.Rules...),
+	}
+}
+
+// kind の情報を返す。登録されていなければ名前に番号を使う。
+func (r *KindRegistry) Info(kind Kind) KindInfo {
+	if info, ok := r.Kinds[kind]; ok {
+		return info
+	}
+
+	return KindInfo{Name: fmt.Sprintf("kind-%d", int(kind)), Symbol: '?'}
+}
+
+// Target が target である規則を返す。
+func (r *KindRegistry) RulesOn(target Kind) (res []ScoreRule) {
+	for _, rule := range r.Rules {
+		if rule.Target == target {
+			res = append(res, rule)
+		}
+	}
+
+	return
+}
+
+// 見られると得点を奪われる (捕まえられる) Kind か。
+func (r *KindRegistry) IsPrey(kind Kind) bool {
+	for _, rule := range r.RulesOn(kind) {
+		if rule.Point > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *KindRegistry) validate() (errs []error) {
+	// 設定し忘れた (ゼロ値の) ままだと得点が一切動かなくなるので弾く
+	if len(r.Kinds) == 0 {
+		return []error{fmt.Errorf("no kind is registered")}
+	}
+
+	kinds := make([]Kind, 0, len(r.Kinds))
+	for kind := range r.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	for _, kind := range kinds {
+		if info := r.Kinds[kind]; info.GuardRange < 0 {
+			errs = append(errs, fmt.Errorf(
+				"kind %s: negative guard range: %f", info.Name, info.GuardRange,
+			))
+		}
+	}
+
+	for idx, rule := range r.Rules {
+		for _, kind := range []Kind{rule.Watcher, rule.Target} {
+			if _, ok := r.Kinds[kind]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"score rule %d: unknown kind %d", idx, int(kind),
+				))
+			}
+		}
+	}
+
+	return
+}
+
+// target が、近くにいる同じ Squad の Guard に守られているか。
+func (g *Game) isGuarded(target *Agent) bool {
+	for idx := range g.Agents {
+		guard := &g.Agents[idx]
+		if guard.ID == target.ID || guard.SquadID != target.SquadID || !guard.IsOnField() {
+			continue
+		}
+
+		guardRange := g.Config.Kinds.Info(guard.Kind).GuardRange
+		if guardRange > 0 && guard.Pos.DistanceTo(target.Pos) <= guardRange {
+			return true
+		}
+	}
+
+	return false
+}
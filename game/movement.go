@@ -0,0 +1,134 @@
+package game
+
+import (
+	"math"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+type MovementMode int
+
+const (
+	// 移動先へ移動できなければ移動しない
+	MovementReject MovementMode = iota
+	// 移動できるところまで移動し、残りは壁に沿って滑るように移動する
+	MovementSlide
+)
+
+// 壁から少しだけ離しておく距離。遮蔽物や立ち入り禁止区域の辺にぴったり乗っ
+// てしまうと、交差判定で通り抜けられてしまうことがある。
+const slideMargin = 1e-6
+
+// 移動を妨げる線分。normal は移動してきた側を向く単位法線。
+type wall struct {
+	segment geom.Segment
+	normal  geom.Vector
+	// normal が決まっている (フィールドの端の) 場合は true
+	fixed  bool
+	margin float64
+}
+
+// a の移動を妨げる壁を集める。
+func (f *Field) wallsFor(a *Agent) []wall {
+	rect := f.Rect
+	rt := geom.NewCoord(rect.RB.X, rect.LT.Y)
+	lb := geom.NewCoord(rect.LT.X, rect.RB.Y)
+
+	// フィールドの端は内向きの法線を持つ。境界上にいても問題ないので離さ
+	// なくてよい。
+	walls := []wall{
+		{geom.NewSegment(rect.LT, rt), geom.NewVector(0, 1), true, 0},
+		{geom.NewSegment(rt, rect.RB), geom.NewVector(-1, 0), true, 0},
+		{geom.NewSegment(rect.RB, lb), geom.NewVector(0, -1), true, 0},
+		{geom.NewSegment(lb, rect.LT), geom.NewVector(1, 0), true, 0},
+	}
+
+	for _, obst := range f.Obsts {
+		if obst.Solid && !obst.Open {
+			walls = append(walls, wall{segment: obst.Segment, margin: slideMargin})
+		}
+	}
+
+	for _, area := range f.Areas {
+		// すでに中にいる場合は出ていけるので MovableTo に合わせて壁としない
+		if !area.NoGo || area.Polygon.Contains(a.Pos) {
+			continue
+		}
+
+		for _, edge := range area.Polygon.Edges() {
+			walls = append(walls, wall{segment: edge, margin: slideMargin})
+		}
+	}
+
+	return walls
+}
+
+// a が vec だけ移動しようとしたときに、壁に沿って滑りながら実際にたどり着
+// く位置を返す。
+func (f *Field) slide(a *Agent, vec geom.Vector) geom.Coord {
+	walls := f.wallsFor(a)
+	pos := a.Pos
+	rem := vec
+
+	// 角に入り込んだ場合に備えて、滑る回数には上限を設ける
+	for iter := 0; iter < 4 && rem.Length() > 1e-12; iter++ {
+		path := geom.NewSegment(pos, pos.Add(rem).AsCoord())
+
+		hitT := math.Inf(1)
+		var hit geom.Coord
+		var hitWall wall
+		for _, w := range walls {
+			p, ok := w.segment.Intersection(path)
+			if !ok {
+				continue
+			}
+
+			normal := w.normal
+			if !w.fixed {
+				normal = facingNormal(w.segment, pos, rem)
+			}
+
+			// 壁から離れていく向きであれば妨げられない
+			if rem.Dot(normal) >= 0 {
+				continue
+			}
+
+			t := p.Sub(pos.Vector).Dot(rem) / rem.Dot(rem)
+			if t < hitT {
+				hitT = t
+				hit = p
+				hitWall = w
+				hitWall.normal = normal
+			}
+		}
+
+		if math.IsInf(hitT, 1) {
+			pos = path.B
+			break
+		}
+
+		// 壁にぶつかるところまで進み、残りは壁に沿った成分だけ滑らせる
+		tangent := hitWall.segment.B.Sub(hitWall.segment.A.Vector).Normalize()
+		left := path.B.Sub(hit.Vector)
+		rem = tangent.MulScalar(left.Dot(tangent))
+		pos = hit.Add(hitWall.normal.MulScalar(hitWall.margin)).AsCoord()
+	}
+
+	return pos
+}
+
+// 線分 s の法線のうち、pos のある側を向くものを返す。pos が線分の延長上に
+// ある場合は rem に逆らう向きとする。
+func facingNormal(s geom.Segment, pos geom.Coord, rem geom.Vector) geom.Vector {
+	normal := s.B.Sub(s.A.Vector).Normalize().Rotate(math.Pi / 2)
+	side := pos.Sub(s.A.Vector).Dot(normal)
+	if math.Abs(side) < 1e-12 {
+		side = -rem.Dot(normal)
+	}
+
+	if side < 0 {
+		return normal.MulScalar(-1)
+	}
+
+	return normal
+}
@@ -0,0 +1,141 @@
+package game
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+// 観測モデル。見えている Agent の位置をどれだけ正確に知ることができるか。
+type ObservationConfig struct {
+	// 距離 1 あたりの位置の誤差 (各軸の正規分布の標準偏差)
+	NoisePerDistance float64
+	// 距離 0 で見えている Agent を検出できる確率
+	DetectionProb float64
+	// 距離 1 あたりに検出できる確率が下がる量
+	DetectionFalloff float64
+	// 何ターン前の位置が報告されるか
+	Delay int
+}
+
+func DefaultObservationConfig() *ObservationConfig {
+	return &ObservationConfig{
+		NoisePerDistance: 0,
+		DetectionProb:    1,
+		DetectionFalloff: 0,
+		Delay:            0,
+	}
+}
+
+func (c *ObservationConfig) WithNoise(noisePerDistance float64) *ObservationConfig {
+	c.NoisePerDistance = noisePerDistance
+	return c
+}
+
+func (c *ObservationConfig) WithDetection(prob, falloff float64) *ObservationConfig {
+	c.DetectionProb = prob
+	c.DetectionFalloff = falloff
+	return c
+}
+
+func (c *ObservationConfig) WithDelay(delay int) *ObservationConfig {
+	c.Delay = delay
+	return c
+}
+
+func (c *ObservationConfig) validate() error {
+	if c.NoisePerDistance < 0 || c.DetectionFalloff < 0 || c.Delay < 0 {
+		return fmt.Errorf(
+			"negative observation parameter: noise %f, falloff %f, delay %d",
+			c.NoisePerDistance, c.DetectionFalloff, c.Delay,
+		)
+	}
+
+	if c.DetectionProb < 0 || 1 < c.DetectionProb {
+		return fmt.Errorf("invalid detection probability: %f", c.DetectionProb)
+	}
+
+	return nil
+}
+
+func (c *ObservationConfig) detectionProbAt(dist float64) float64 {
+	return math.Max(0, math.Min(c.DetectionProb-c.DetectionFalloff*dist, 1))
+}
+
+// observer から target がどう見えるかを返す。見えていないか、観測モデルに
+// よって検出できなかった場合は false を返す。
+//
+// 自分自身と同じ Squad の仲間の状態は正確に分かるものとする。ほかの Squad
+// の Agent は ObservationConfig.Delay ターン前の状態が報告される。
+func (g *Game) observe(observer, target *Agent) (Agent, bool) {
+	if !observer.IsWatching(target, g) {
+		return Agent{}, false
+	}
+
+	if target.SquadID == observer.SquadID {
+		return observer.viewOf(target), true
+	}
+
+	// 報告されるのは位置だけでなく、向きや種類なども含めて遅れた状態
+	cfg := &g.Config.Observation
+	view := observer.viewOf(target.pastState(cfg.Delay))
+	dist := observer.Pos.DistanceTo(target.Pos)
+	prob := cfg.detectionProbAt(dist)
+	sigma := cfg.NoisePerDistance * dist
+
+	// 乱数生成器を作るのは重いので、必要なときだけ作る
+	if prob >= 1 && sigma <= 0 {
+		return view, true
+	}
+
+	rng := g.newRand(randSaltObservation, int64(observer.ID), int64(target.ID))
+	if rng.Float64() >= prob {
+		return Agent{}, false
+	}
+
+	if sigma > 0 {
+		noise := geom.NewVector(rng.NormFloat64()*sigma, rng.NormFloat64()*sigma)
+		view.Pos = view.Pos.Add(noise).AsCoord()
+	}
+
+	return view, true
+}
+
+// delay ターン前の終わりの状態を返す。そこまでの記録がなければ最も古い状態
+// を返す。
+func (a *Agent) pastState(delay int) *Agent {
+	if delay <= 0 || len(a.History) == 0 {
+		return a
+	}
+
+	idx := len(a.History) - 1 - delay
+	if idx < 0 {
+		idx = 0
+	}
+
+	return &a.History[idx]
+}
+
+// 全員の現在の状態を履歴に追加する。
+func (g *Game) recordHistory() {
+	for idx := range g.Agents {
+		g.Agents[idx].recordHistory(g.Config.Observation.Delay)
+	}
+}
+
+// 現在の状態を履歴に追加する。履歴は現在の状態を含めて delay + 1 ターン分
+// だけ保持する。
+func (a *Agent) recordHistory(delay int) {
+	if delay <= 0 {
+		a.History = []Agent{}
+		return
+	}
+
+	snapshot := a.Clone()
+	snapshot.History = []Agent{}
+	a.History = append(a.History, snapshot)
+	if len(a.History) > delay+1 {
+		a.History = a.History[len(a.History)-delay-1:]
+	}
+}
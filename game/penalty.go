@@ -0,0 +1,152 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+type InvalidActionPolicy int
+
+const (
+	// 不正な行動は単に無視する (その場にとどまる)
+	InvalidIgnore InvalidActionPolicy = iota
+	// 移動できない場所へ移動しようとした場合は、移動できる限界まで移動する。
+	// それ以外の不正な行動は無視する。
+	InvalidClamp
+	// Penalty だけ得点を失う
+	InvalidPointPenalty
+	// FreezeTurns ターンの間行動できなくなる
+	InvalidFreeze
+	// 失格となりフィールドから取り除かれる
+	InvalidDisqualify
+)
+
+func (p InvalidActionPolicy) String() string {
+	switch p {
+	case InvalidIgnore:
+		return "ignore"
+	case InvalidClamp:
+		return "clamp"
+	case InvalidPointPenalty:
+		return "point penalty"
+	case InvalidFreeze:
+		return "freeze"
+	case InvalidDisqualify:
+		return "disqualify"
+	default:
+		return fmt.Sprintf("InvalidActionPolicy(%d)", int(p))
+	}
+}
+
+// エージェントが不正な行動を取ったときの扱い。
+type InvalidActionConfig struct {
+	Policy      InvalidActionPolicy
+	Penalty     float64
+	FreezeTurns int
+}
+
+func DefaultInvalidActionConfig() *InvalidActionConfig {
+	return &InvalidActionConfig{
+		Policy:      InvalidIgnore,
+		Penalty:     0,
+		FreezeTurns: 0,
+	}
+}
+
+func (c *InvalidActionConfig) WithClamp() *InvalidActionConfig {
+	c.Policy = InvalidClamp
+	return c
+}
+
+func (c *InvalidActionConfig) WithPointPenalty(penalty float64) *InvalidActionConfig {
+	c.Policy = InvalidPointPenalty
+	c.Penalty = penalty
+	return c
+}
+
+func (c *InvalidActionConfig) WithFreeze(turns int) *InvalidActionConfig {
+	c.Policy = InvalidFreeze
+	c.FreezeTurns = turns
+	return c
+}
+
+func (c *InvalidActionConfig) WithDisqualify() *InvalidActionConfig {
+	c.Policy = InvalidDisqualify
+	return c
+}
+
+func (c *InvalidActionConfig) validate() error {
+	if c.Policy < InvalidIgnore || InvalidDisqualify < c.Policy {
+		return fmt.Errorf("unknown invalid action policy: %v", c.Policy)
+	}
+
+	if c.Penalty < 0 || c.FreezeTurns < 0 {
+		return fmt.Errorf(
+			"negative invalid action penalty: point %f, freeze %d",
+			c.Penalty, c.FreezeTurns,
+		)
+	}
+
+	return nil
+}
+
+// エージェントに科された罰。
+type Penalty struct {
+	Policy InvalidActionPolicy
+	// 罰の原因となった不正な行動のエラー
+	Reason string
+}
+
+// 不正な行動を取ったエージェントに設定どおりの罰を科す。
+func (g *Game) penalize(a *Agent, err error) {
+	cfg := &g.Config.InvalidAction
+
+	a.Violations++
+	a.Penalty = &Penalty{
+		Policy: cfg.Policy,
+		Reason: err.Error(),
+	}
+
+	switch cfg.Policy {
+	case InvalidPointPenalty:
+		if cfg.Penalty == 0 {
+			break
+		}
+
+		a.PointGains = append(a.PointGains, PointGain{
+			AgentIDGainedFrom: NoAgentID,
+			Gain:              -cfg.Penalty,
+		})
+		g.addPointFor(a, -cfg.Penalty)
+		g.addEvent(Event{
+			Type:     EventPointTransfer,
+			AgentID:  a.ID,
+			OtherIDs: []int{NoAgentID},
+			Value:    -cfg.Penalty,
+			Reason:   "invalid action",
+		})
+	case InvalidFreeze:
+		a.FrozenTurns = cfg.FreezeTurns
+	case InvalidDisqualify:
+		a.Disqualified = true
+	}
+}
+
+// from から to へ向かう線分上で、a が移動できるもっとも遠い位置を探す。
+// フィールドは凸で、立ち入り禁止区域は通り抜けられないので、移動できる範
+// 囲は線分の先頭からの連続した区間になる。
+func (f *Field) farthestMovable(a *Agent, to geom.Coord) geom.Coord {
+	vec := to.Sub(a.Pos.AsVector())
+	lo, hi := 0.0, 1.0
+	for iter := 0; iter < 50; iter++ {
+		mid := (lo + hi) / 2
+		if f.MovableTo(a, a.Pos.Add(vec.MulScalar(mid)).AsCoord()) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return a.Pos.Add(vec.MulScalar(lo)).AsCoord()
+}
@@ -0,0 +1,108 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+)
+
+// あるエージェントがこのターンに行おうとしている行動の結果。
+type actionPlan struct {
+	// 行動した後のエージェントの状態
+	agent Agent
+	ok    bool
+	// 行動が不正だった場合のエラー。この場合 agent は行動前のまま
+	err error
+	// 適用したときに記録する出来事
+	events []Event
+	// 仲間へ送ろうとしているメッセージ
+	message string
+}
+
+// 行動前の a の状態に戻し、err によって行動が拒否されたことにする。
+func (p *actionPlan) reject(a *Agent, err error) {
+	p.agent = a.Clone()
+	p.ok = false
+	p.err = err
+	p.events = nil
+	p.message = ""
+}
+
+// Squad ごとの帯域を超えるメッセージを拒否する。どのメッセージを通すかは
+// エージェントの順番ではなくメッセージの内容だけで決まる: 短い (同じ長さ
+// なら辞書順で先の) メッセージから順に、帯域に収まる限り通す。同じ内容の
+// メッセージはまとめて通すか拒否するかのどちらかとし、誰が送ったかで差が
+// つかないようにする。
+func (g *Game) resolveMessages(plans []actionPlan) {
+	bandwidth := g.Config.MessageBandwidth
+	if bandwidth <= 0 {
+		return
+	}
+
+	// Squad ごとに、送ろうとしているメッセージの計画を集める
+	bySquad := map[int][]*actionPlan{}
+	for idx := range plans {
+		p := &plans[idx]
+		if p.err == nil && p.message != "" {
+			bySquad[p.agent.SquadID] = append(bySquad[p.agent.SquadID], p)
+		}
+	}
+
+	for squadID, requests := range bySquad {
+		sort.SliceStable(requests, func(i, j int) bool {
+			mi, mj := requests[i].message, requests[j].message
+			if len(mi) != len(mj) {
+				return len(mi) < len(mj)
+			}
+			return mi < mj
+		})
+
+		used := g.Squads[squadID].MessageBytes
+		for start := 0; start < len(requests); {
+			// 同じ内容のメッセージの範囲 [start, end)
+			end := start + 1
+			for end < len(requests) && requests[end].message == requests[start].message {
+				end++
+			}
+
+			size := len(requests[start].message) * (end - start)
+			if used+size <= bandwidth {
+				used += size
+			} else {
+				for _, p := range requests[start:end] {
+					original := &g.Agents[p.agent.ID]
+					p.reject(original, fmt.Errorf(
+						"squad bandwidth exceeded: %d + %d bytes (max %d)",
+						used, len(p.message), bandwidth,
+					))
+				}
+			}
+
+			start = end
+		}
+	}
+}
+
+// 計画どおりに Game を書き換える。
+func (g *Game) applyPlan(p *actionPlan) {
+	agent := &g.Agents[p.agent.ID]
+	*agent = p.agent
+
+	for _, e := range p.events {
+		g.addEvent(e)
+	}
+
+	if p.message != "" {
+		g.Squads[agent.SquadID].MessageBytes += len(p.message)
+		agent.Outbox = p.message
+	}
+
+	if p.err != nil {
+		g.addEvent(Event{
+			Type:    EventActionRejected,
+			AgentID: agent.ID,
+			From:    agent.Pos,
+			Reason:  p.err.Error(),
+		})
+		g.penalize(agent, p.err)
+	}
+}
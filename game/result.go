@@ -0,0 +1,176 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 時間切れを待たずにゲームを終わらせる条件。ゼロ値の条件は使わない。
+type EndConditions struct {
+	// いずれかの Squad の総得点がこれ以上になったら終わる
+	ScoreThreshold float64
+	// Runner (KindRegistry.IsPrey な Kind) が全員捕まったら終わる
+	// (CaptureConfig が必要)
+	AllRunnersCaptured bool
+	// 首位の Squad が 2 位にこれ以上の差をつけたら終わる
+	LeadMargin float64
+	// 誰も動かないターンがこれだけ続いたら終わる
+	IdleTurns int
+}
+
+func NewEndConditions() *EndConditions {
+	return &EndConditions{}
+}
+
+func (c *EndConditions) WithScoreThreshold(threshold float64) *EndConditions {
+	c.ScoreThreshold = threshold
+	return c
+}
+
+func (c *EndConditions) WithAllRunnersCaptured() *EndConditions {
+	c.AllRunnersCaptured = true
+	return c
+}
+
+func (c *EndConditions) WithLeadMargin(margin float64) *EndConditions {
+	c.LeadMargin = margin
+	return c
+}
+
+func (c *EndConditions) WithIdleTurns(turns int) *EndConditions {
+	c.IdleTurns = turns
+	return c
+}
+
+func (c *EndConditions) validate() error {
+	if c.ScoreThreshold < 0 || c.LeadMargin < 0 || c.IdleTurns < 0 {
+		return fmt.Errorf(
+			"negative end condition: score threshold %f, lead margin %f, idle turns %d",
+			c.ScoreThreshold, c.LeadMargin, c.IdleTurns,
+		)
+	}
+
+	return nil
+}
+
+type EndReason string
+
+const (
+	EndReasonTimeUp             EndReason = "time up"
+	EndReasonScoreThreshold     EndReason = "score threshold"
+	EndReasonAllRunnersCaptured EndReason = "all runners captured"
+	EndReasonLeadMargin         EndReason = "lead margin"
+	EndReasonIdle               EndReason = "idle"
+)
+
+// 勝者がいない (首位が同点の) 場合の Result.Winner
+const NoSquadID = -1
+
+type Result struct {
+	Winner int
+	// 総得点の高い順 (同点なら ID 順) に並べた Squad の ID
+	Ranking []int
+	Reason  EndReason
+}
+
+func (r *Result) Clone() *Result {
+	if r == nil {
+		return nil
+	}
+
+	return &Result{
+		Winner:  r.Winner,
+		Ranking: append([]int{}, r.Ranking...),
+		Reason:  r.Reason,
+	}
+}
+
+// ターンの終わりに終了条件を調べ、満たされていれば Result を決める。
+func (g *Game) updateResult(moved bool) {
+	if moved {
+		g.IdleTurns = 0
+	} else {
+		g.IdleTurns++
+	}
+
+	reason, ok := g.checkEndConditions()
+	if !ok {
+		return
+	}
+
+	ranking := g.ranking()
+	winner := NoSquadID
+	if len(ranking) == 1 ||
+		(len(ranking) > 1 && g.Squads[ranking[0]].TotalPoint > g.Squads[ranking[1]].TotalPoint) {
+		winner = ranking[0]
+	}
+
+	g.Result = &Result{
+		Winner:  winner,
+		Ranking: ranking,
+		Reason:  reason,
+	}
+}
+
+func (g *Game) checkEndConditions() (EndReason, bool) {
+	if c := g.Config.End; c != nil {
+		ranking := g.ranking()
+
+		if c.ScoreThreshold > 0 && len(ranking) > 0 &&
+			g.Squads[ranking[0]].TotalPoint >= c.ScoreThreshold {
+			return EndReasonScoreThreshold, true
+		}
+
+		if c.AllRunnersCaptured && g.allRunnersCaptured() {
+			return EndReasonAllRunnersCaptured, true
+		}
+
+		if c.LeadMargin > 0 && len(ranking) > 1 &&
+			g.Squads[ranking[0]].TotalPoint-g.Squads[ranking[1]].TotalPoint >= c.LeadMargin {
+			return EndReasonLeadMargin, true
+		}
+
+		if c.IdleTurns > 0 && g.IdleTurns >= c.IdleTurns {
+			return EndReasonIdle, true
+		}
+	}
+
+	if g.TimeRemaining == 0 {
+		return EndReasonTimeUp, true
+	}
+
+	return "", false
+}
+
+func (g *Game) allRunnersCaptured() bool {
+	found := false
+	for idx := range g.Agents {
+		if !g.Config.Kinds.IsPrey(g.Agents[idx].Kind) {
+			continue
+		}
+
+		// 失格となった Runner も捕まったものとみなす
+		if g.Agents[idx].IsOnField() {
+			return false
+		}
+		found = true
+	}
+
+	// Infection では捕まった Runner は Runner でなくなるので、Runner が残っ
+	// ていなければ全員捕まったことになる
+	infection := g.Config.RoleSwitch != nil && g.Config.RoleSwitch.Infection
+	return found || infection
+}
+
+func (g *Game) ranking() []int {
+	ranking := make([]int, 0, len(g.Squads))
+	for idx := range g.Squads {
+		ranking = append(ranking, g.Squads[idx].ID)
+	}
+
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return g.Squads[ranking[i]].TotalPoint > g.Squads[ranking[j]].TotalPoint
+	})
+
+	return ranking
+}
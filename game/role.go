@@ -0,0 +1,106 @@
+package game
+
+import "fmt"
+
+// ゲームの途中で役割 (Kind) を入れ替える規則。
+type RoleSwitchConfig struct {
+	// SwapInterval ターンごとに Hunter と Runner を入れ替える。0 なら入れ替
+	// えない。
+	SwapInterval int
+	// 捕まった Runner がフィールドから取り除かれる代わりに、捕まえた側の
+	// Kind になる (CaptureConfig が必要)。
+	Infection bool
+}
+
+func NewRoleSwitchConfig() *RoleSwitchConfig {
+	return &RoleSwitchConfig{
+		SwapInterval: 0,
+		Infection:    false,
+	}
+}
+
+func (c *RoleSwitchConfig) WithSwap(interval int) *RoleSwitchConfig {
+	c.SwapInterval = interval
+	return c
+}
+
+func (c *RoleSwitchConfig) WithInfection() *RoleSwitchConfig {
+	c.Infection = true
+	return c
+}
+
+func (c *RoleSwitchConfig) validate(capture *CaptureConfig) error {
+	if c.SwapInterval < 0 {
+		return fmt.Errorf("negative swap interval: %d", c.SwapInterval)
+	}
+
+	if c.Infection && capture == nil {
+		return fmt.Errorf("infection requires capture config")
+	}
+
+	return nil
+}
+
+// あるエージェントの役割が変わったこと。
+type RoleChange struct {
+	AgentID int
+	From    Kind
+	To      Kind
+}
+
+func (g *Game) changeRole(a *Agent, to Kind, reason string) {
+	change := RoleChange{
+		AgentID: a.ID,
+		From:    a.Kind,
+		To:      to,
+	}
+
+	a.Kind = to
+	g.RoleChanges = append(g.RoleChanges, change)
+	g.addEvent(Event{
+		Type:    EventRoleChange,
+		AgentID: a.ID,
+		From:    a.Pos,
+		To:      a.Pos,
+		Kind:    to,
+		Reason:  reason,
+	})
+}
+
+// 捕まった prey を capturers の Kind に変える。
+func (g *Game) infect(prey *Agent, capturers []int) {
+	to := g.Agents[capturers[0]].Kind
+	prey.CaptureProgress = 0
+	g.changeRole(prey, to, "infection")
+}
+
+// SwapInterval ターンごとに Hunter と Runner を入れ替える。
+func (g *Game) swapRoles() {
+	cfg := g.Config.RoleSwitch
+	if cfg == nil || cfg.SwapInterval <= 0 || g.Turn()%cfg.SwapInterval != 0 {
+		return
+	}
+
+	for idx := range g.Agents {
+		agent := &g.Agents[idx]
+		switch agent.Kind {
+		case Hunter:
+			g.changeRole(agent, Runner, "swap")
+		case Runner:
+			g.changeRole(agent, Hunter, "swap")
+		}
+
+		// 逃げる側でなくなったので捕まりかけていたことは忘れる
+		agent.CaptureProgress = 0
+	}
+}
+
+// 次に役割が入れ替わるまでのターン数。入れ替わらないなら 0。
+func (g *Game) turnsUntilSwap() int {
+	cfg := g.Config.RoleSwitch
+	if cfg == nil || cfg.SwapInterval <= 0 {
+		return 0
+	}
+
+	return cfg.SwapInterval - g.Turn()%cfg.SwapInterval
+}
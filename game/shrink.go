@@ -0,0 +1,152 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+type ShrinkPolicy int
+
+const (
+	// 場外にいるエージェントは毎ターン Penalty だけ得点を失う
+	ShrinkPenalty ShrinkPolicy = iota
+	// フィールドそのものが縮み、場外にいるエージェントは内側へ押し出される
+	ShrinkPush
+)
+
+// StartTurn から EndTurn にかけて、安全地帯を Field.Rect から FinalRect まで
+// 線形に縮める。
+type ShrinkConfig struct {
+	StartTurn int
+	EndTurn   int
+	FinalRect geom.Rect
+	Policy    ShrinkPolicy
+	Penalty   float64
+}
+
+func NewShrinkConfig(startTurn, endTurn int, finalRect geom.Rect) *ShrinkConfig {
+	return &ShrinkConfig{
+		StartTurn: startTurn,
+		EndTurn:   endTurn,
+		FinalRect: finalRect,
+		Policy:    ShrinkPenalty,
+		Penalty:   1.0,
+	}
+}
+
+func (c *ShrinkConfig) WithPenalty(penalty float64) *ShrinkConfig {
+	c.Policy = ShrinkPenalty
+	c.Penalty = penalty
+	return c
+}
+
+func (c *ShrinkConfig) WithPush() *ShrinkConfig {
+	c.Policy = ShrinkPush
+	return c
+}
+
+func (c *ShrinkConfig) validate(field geom.Rect) error {
+	if c.StartTurn < 0 || c.EndTurn < c.StartTurn {
+		return fmt.Errorf(
+			"invalid shrink schedule: from %d to %d",
+			c.StartTurn, c.EndTurn,
+		)
+	}
+
+	if !field.Contains(c.FinalRect.LT) || !field.Contains(c.FinalRect.RB) {
+		return fmt.Errorf("final rect %v is not inside field %v", c.FinalRect, field)
+	}
+
+	if c.Penalty < 0 {
+		return fmt.Errorf("negative shrink penalty: %f", c.Penalty)
+	}
+
+	return nil
+}
+
+// turn ターン目の安全地帯を返す。
+func (c *ShrinkConfig) rectAt(initial geom.Rect, turn int) geom.Rect {
+	if turn <= c.StartTurn {
+		return initial
+	}
+
+	if turn >= c.EndTurn {
+		return c.FinalRect
+	}
+
+	frac := float64(turn-c.StartTurn) / float64(c.EndTurn-c.StartTurn)
+	lerp := func(from, to geom.Coord) geom.Coord {
+		return from.Add(to.Sub(from.Vector).MulScalar(frac)).AsCoord()
+	}
+
+	return geom.NewRect(
+		lerp(initial.LT, c.FinalRect.LT),
+		lerp(initial.RB, c.FinalRect.RB),
+	)
+}
+
+// 安全地帯を現在のターンの大きさにする。押し出す場合はフィールドごと縮め、
+// 場外にいるエージェントを内側へ移動させる。
+func (g *Game) updateSafeRect() {
+	shrink := g.Config.Shrink
+	if shrink == nil {
+		return
+	}
+
+	g.Field.SafeRect = shrink.rectAt(g.Config.Field.Rect, g.Turn())
+	if shrink.Policy != ShrinkPush {
+		return
+	}
+
+	g.Field.Rect = g.Field.SafeRect
+	for idx := range g.Agents {
+		g.Field.pushInside(&g.Agents[idx])
+	}
+}
+
+// 場外にいる a をフィールドの内側へ押し込む。通常の移動と同じく、通り抜け
+// られない遮蔽物や立ち入り禁止区域は越えずにそれに沿って滑る。押し込めなけ
+// れば、滑ってたどり着いたところ (場外のこともある) にとどまる。
+func (f *Field) pushInside(a *Agent) {
+	target := f.Rect.Clamp(a.Pos)
+	if target == a.Pos {
+		return
+	}
+
+	// 壁にぴったり乗ってしまうと次に押されたときに通り抜けられるので、ぶつ
+	// からない場合も slide で少し離しておく
+	target = f.slide(a, target.Sub(a.Pos.Vector))
+	if f.passable(a, target) {
+		a.Pos = target
+	}
+}
+
+// 安全地帯の外にいるエージェントから得点を奪う。
+func (g *Game) penalizeOutsiders() {
+	shrink := g.Config.Shrink
+	if shrink == nil || shrink.Policy != ShrinkPenalty || shrink.Penalty == 0 {
+		return
+	}
+
+	for idx := range g.Agents {
+		agent := &g.Agents[idx]
+		// フィールドから取り除かれているエージェントは場外にいるわけではない
+		if !agent.IsOnField() || g.Field.SafeRect.Contains(agent.Pos) {
+			continue
+		}
+
+		agent.PointGains = append(agent.PointGains, PointGain{
+			AgentIDGainedFrom: NoAgentID,
+			Gain:              -shrink.Penalty,
+		})
+		g.addPointFor(agent, -shrink.Penalty)
+		g.addEvent(Event{
+			Type:     EventPointTransfer,
+			AgentID:  agent.ID,
+			OtherIDs: []int{NoAgentID},
+			Value:    -shrink.Penalty,
+			Reason:   "outside of safe rect",
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+// 出現場所の候補を試す回数
+const spawnAttempts = 100
+
+// エージェントが出現する領域。Squad や Kind を指定すると、それに当てはまる
+// エージェントだけがここに出現する。当てはまる領域が複数あれば先に追加した
+// ものを使う。
+//
+// WithInitPos で位置を指定したエージェントは領域に関係なくその位置に出現す
+// る。
+type SpawnZoneConfig struct {
+	Rect geom.Rect
+	// 空文字列ならどの Squad にも当てはまる
+	Squad string
+	// nil ならどの Kind にも当てはまる
+	Kind *Kind
+}
+
+func NewSpawnZoneConfig(rect geom.Rect) *SpawnZoneConfig {
+	return &SpawnZoneConfig{
+		Rect:  rect,
+		Squad: "",
+		Kind:  nil,
+	}
+}
+
+func (c *SpawnZoneConfig) ForSquad(name string) *SpawnZoneConfig {
+	c.Squad = name
+	return c
+}
+
+func (c *SpawnZoneConfig) ForKind(kind Kind) *SpawnZoneConfig {
+	c.Kind = &kind
+	return c
+}
+
+func (c *SpawnZoneConfig) Clone() SpawnZoneConfig {
+	cloned := *c
+	if c.Kind != nil {
+		kind := *c.Kind
+		cloned.Kind = &kind
+	}
+	return cloned
+}
+
+func (c *SpawnZoneConfig) matches(squad string, kind Kind) bool {
+	return (c.Squad == "" || c.Squad == squad) && (c.Kind == nil || *c.Kind == kind)
+}
+
+func (c *SpawnZoneConfig) validate(field geom.Rect) error {
+	if c.Rect.Width() < 0 || c.Rect.Height() < 0 {
+		return fmt.Errorf("rect %v has negative size", c.Rect)
+	}
+
+	if !field.Contains(c.Rect.LT) || !field.Contains(c.Rect.RB) {
+		return fmt.Errorf("rect %v is not inside field %v", c.Rect, field)
+	}
+
+	return nil
+}
+
+// Squad に割り当てられた出現する領域を入れ替える。i 番目の Squad の領域は
+// (i+shift) 番目の Squad のものになる。Squad を指定しない領域と、どの Squad
+// の名前とも一致しない領域はそのまま。
+func (c *GameConfig) WithSpawnZonesRotated(shift int) *GameConfig {
+	if len(c.Squads) == 0 {
+		return c
+	}
+
+	indices := map[string]int{}
+	for idx, squad := range c.Squads {
+		indices[squad.Name] = idx
+	}
+
+	for idx := range c.Field.SpawnZones {
+		zone := &c.Field.SpawnZones[idx]
+		if from, ok := indices[zone.Squad]; ok && zone.Squad != "" {
+			n := len(c.Squads)
+			zone.Squad = c.Squads[((from+shift)%n+n)%n].Name
+		}
+	}
+
+	return c
+}
+
+// a が出現する領域を返す。当てはまる領域がなければ nil。
+func (c *GameConfig) spawnZoneFor(a *Agent) *SpawnZoneConfig {
+	squad := c.Squads[a.SquadID].Name
+	for idx := range c.Field.SpawnZones {
+		if zone := &c.Field.SpawnZones[idx]; zone.matches(squad, a.Kind) {
+			return zone
+		}
+	}
+
+	return nil
+}
+
+// WithInitPos で位置を指定されていないエージェントを、出現する領域の中に
+// 置く。位置の決まっているエージェントを先に置いたものとして、残りを ID の
+// 順に一人ずつ置いていく。条件を満たす位置が見つからなかったエージェント
+// があればエラーを返す (それでも試した中で最もよい位置には置く) 。
+func (g *Game) placeAgents() (errs error) {
+	var placed, rest []*Agent
+	for idx := range g.Agents {
+		agent := &g.Agents[idx]
+		fixed := g.Config.Squads[agent.SquadID].Agents[agent.InSquadID].FixedInitPos
+		if fixed || g.Config.spawnZoneFor(agent) == nil {
+			placed = append(placed, agent)
+		} else {
+			rest = append(rest, agent)
+		}
+	}
+
+	rng := g.newRand(randSaltSpawn)
+	for _, agent := range rest {
+		others := make([]Agent, 0, len(placed))
+		for _, other := range placed {
+			others = append(others, *other)
+		}
+
+		pos, err := g.findSpawnPos(agent, g.Config.spawnZoneFor(agent), rng, others)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"agent %s: %w", g.DescribeAgent(agent), err,
+			))
+		}
+
+		agent.Pos = pos
+		placed = append(placed, agent)
+	}
+
+	return
+}
+
+// 復帰するときの位置。出現する領域があればその中から改めて選び、なければ
+// 初期位置とする。
+func (g *Game) respawnPosFor(a *Agent) geom.Coord {
+	config := &g.Config.Squads[a.SquadID].Agents[a.InSquadID]
+	zone := g.Config.spawnZoneFor(a)
+	if config.FixedInitPos || zone == nil {
+		return config.InitPos
+	}
+
+	var others []Agent
+	for idx := range g.Agents {
+		if other := &g.Agents[idx]; other.ID != a.ID && other.IsOnField() {
+			others = append(others, *other)
+		}
+	}
+
+	// ゲームの途中では混み合っていても復帰させないわけにはいかないので、
+	// 条件を満たさなくても試した中で最もよい位置に置く
+	rng := g.newRand(randSaltSpawn, int64(a.ID))
+	pos, _ := g.findSpawnPos(a, zone, rng, others)
+	return pos
+}
+
+// zone の中で、遮蔽物や立ち入り禁止区域を避け、others から
+// MinSpawnSeparation 以上離れた位置を探す。見つからなければエラーとともに、
+// 試した中で others から最も離れた位置 (遮蔽物などを避けられる位置がひと
+// つもなければ zone の中央) を返す。
+func (g *Game) findSpawnPos(
+	a *Agent,
+	zone *SpawnZoneConfig,
+	rng *rand.Rand,
+	others []Agent,
+) (geom.Coord, error) {
+	separation := g.Config.Field.MinSpawnSeparation
+
+	best := zone.Rect.Center()
+	bestDist := math.Inf(-1)
+	for attempt := 0; attempt < spawnAttempts; attempt++ {
+		pos := geom.NewCoord(
+			zone.Rect.LT.X+rng.Float64()*zone.Rect.Width(),
+			zone.Rect.LT.Y+rng.Float64()*zone.Rect.Height(),
+		)
+		if !g.Field.isClearForSpawn(pos, g.Config.AgentRadius) {
+			continue
+		}
+
+		nearest := math.Inf(1)
+		for idx := range others {
+			nearest = math.Min(nearest, others[idx].Pos.DistanceTo(pos))
+		}
+
+		if nearest >= separation {
+			return pos, nil
+		}
+
+		if nearest > bestDist {
+			best = pos
+			bestDist = nearest
+		}
+	}
+
+	if math.IsInf(bestDist, -1) {
+		return best, fmt.Errorf(
+			"no position in spawn zone %v is clear of obstructions and no-go areas",
+			zone.Rect,
+		)
+	}
+
+	return best, fmt.Errorf(
+		"cannot keep spawn separation %f in spawn zone %v (best %f)",
+		separation, zone.Rect, bestDist,
+	)
+}
+
+// pos が radius (最低でも少し) 以上遮蔽物から離れていて、立ち入り禁止区域
+// の外にあるか。
+func (f *Field) isClearForSpawn(pos geom.Coord, radius float64) bool {
+	clearance := math.Max(radius, slideMargin)
+	for _, obst := range f.Obsts {
+		if obst.Segment.DistanceTo(pos) < clearance {
+			return false
+		}
+	}
+
+	for _, area := range f.Areas {
+		if area.NoGo && area.Polygon.Contains(pos) {
+			return false
+		}
+	}
+
+	return f.Rect.Contains(pos)
+}
@@ -60,6 +60,31 @@ func (a Vector) Cross(b Vector) float64 {
 	return a.X*b.Y - a.Y*b.X
 }
 
+func (a Vector) Dot(b Vector) float64 {
+	return a.X*b.X + a.Y*b.Y
+}
+
+// 同じ向きの単位ベクトルを返す。零ベクトルの場合は零ベクトルのまま返す。
+func (v Vector) Normalize() Vector {
+	l := v.Length()
+	if l < 1e-12 {
+		return NewVector(0, 0)
+	}
+	return v.MulScalar(1 / l)
+}
+
+// 原点を中心に反時計回りに t ラジアン回転する。
+func (v Vector) Rotate(t float64) Vector {
+	sin, cos := math.Sin(t), math.Cos(t)
+	return NewVector(v.X*cos-v.Y*sin, v.X*sin+v.Y*cos)
+}
+
+// a から b へ回転するときの角度を (-π, π] の範囲で返す。反時計回りが正。
+// どちらかが零ベクトルの場合は 0 を返す。
+func (a Vector) AngleTo(b Vector) float64 {
+	return math.Atan2(a.Cross(b), a.Dot(b))
+}
+
 func NewCoord(x, y float64) Coord {
 	return Coord{Vector: NewVector(x, y)}
 }
@@ -86,6 +111,47 @@ func (v Coord) AsVector() Vector {
 	return v.Vector
 }
 
+func (a Coord) DistanceTo(b Coord) float64 {
+	return b.Sub(a.Vector).Length()
+}
+
+func (r Rect) Width() float64 {
+	return r.RB.X - r.LT.X
+}
+
+func (r Rect) Height() float64 {
+	return r.RB.Y - r.LT.Y
+}
+
+func (r Rect) Center() Coord {
+	return NewCoord((r.LT.X+r.RB.X)/2, (r.LT.Y+r.RB.Y)/2)
+}
+
+// 境界上の点も含む。
+func (r Rect) Contains(p Coord) bool {
+	return r.LT.X <= p.X && p.X <= r.RB.X &&
+		r.LT.Y <= p.Y && p.Y <= r.RB.Y
+}
+
+// p を r の中 (境界を含む) で最も近い点へ移動する。
+func (r Rect) Clamp(p Coord) Coord {
+	return NewCoord(
+		math.Max(r.LT.X, math.Min(p.X, r.RB.X)),
+		math.Max(r.LT.Y, math.Min(p.Y, r.RB.Y)),
+	)
+}
+
+// 角度を (-π, π] の範囲に正規化する。
+func NormalizeAngle(t float64) float64 {
+	t = math.Mod(t, 2*math.Pi)
+	if t > math.Pi {
+		t -= 2 * math.Pi
+	} else if t <= -math.Pi {
+		t += 2 * math.Pi
+	}
+	return t
+}
+
 func NewPolarVector(r, t float64) PolarVector {
 	return PolarVector{R: r, T: t}
 }
@@ -97,6 +163,16 @@ func (p PolarVector) ToVector() Vector {
 	)
 }
 
+// R が非負、T が (-π, π] となるように正規化する。
+func (p PolarVector) Normalize() PolarVector {
+	if p.R < 0 {
+		p.R = -p.R
+		p.T += math.Pi
+	}
+	p.T = NormalizeAngle(p.T)
+	return p
+}
+
 func (v Vector) Length() float64 {
 	return math.Sqrt(v.X*v.X + v.Y*v.Y)
 }
@@ -132,3 +208,106 @@ func (a Segment) Crosses(b Segment) bool {
 	return CCW(a.A, a.B, b.A)*CCW(a.A, a.B, b.B) < 0 &&
 		CCW(b.A, b.B, a.A)*CCW(b.A, b.B, a.B) < 0
 }
+
+// 線分上で p に最も近い点を返す。
+func (s Segment) ClosestPoint(p Coord) Coord {
+	ab := s.B.Sub(s.A.Vector)
+	l2 := ab.Dot(ab)
+	if l2 < 1e-12 {
+		// 長さ 0 の線分
+		return s.A
+	}
+
+	t := p.Sub(s.A.Vector).Dot(ab) / l2
+	t = math.Max(0, math.Min(t, 1))
+	return s.A.Add(ab.MulScalar(t)).AsCoord()
+}
+
+// 線分と点 p との距離を返す。
+func (s Segment) DistanceTo(p Coord) float64 {
+	return s.ClosestPoint(p).DistanceTo(p)
+}
+
+// 二つの線分の交点を返す。端点で接している場合も交点とみなす。平行な場合
+// (同一直線上で重なっている場合を含む) は交点なしとする。
+func (a Segment) Intersection(b Segment) (Coord, bool) {
+	r := a.B.Sub(a.A.Vector)
+	s := b.B.Sub(b.A.Vector)
+	denom := r.Cross(s)
+	if math.Abs(denom) < 1e-12 {
+		return Coord{}, false
+	}
+
+	qp := b.A.Sub(a.A.Vector)
+	t := qp.Cross(s) / denom
+	u := qp.Cross(r) / denom
+	const eps = 1e-9
+	if t < -eps || 1+eps < t || u < -eps || 1+eps < u {
+		return Coord{}, false
+	}
+
+	return a.A.Add(r.MulScalar(t)).AsCoord(), true
+}
+
+// 頂点を順に結んだ多角形。最後の頂点と最初の頂点も結ぶ。
+type Polygon struct {
+	Vertices []Coord
+}
+
+func NewPolygon(vertices ...Coord) Polygon {
+	vs := make([]Coord, len(vertices))
+	copy(vs, vertices)
+	return Polygon{Vertices: vs}
+}
+
+func NewPolygonFromRect(r Rect) Polygon {
+	return NewPolygon(
+		r.LT,
+		NewCoord(r.RB.X, r.LT.Y),
+		r.RB,
+		NewCoord(r.LT.X, r.RB.Y),
+	)
+}
+
+func (p Polygon) Clone() Polygon {
+	return NewPolygon(p.Vertices...)
+}
+
+func (p Polygon) Edges() []Segment {
+	n := len(p.Vertices)
+	edges := make([]Segment, 0, n)
+	for i := 0; i < n; i++ {
+		edges = append(edges, NewSegment(p.Vertices[i], p.Vertices[(i+1)%n]))
+	}
+	return edges
+}
+
+// 点 c が多角形の内部にあるかを返す。境界上の点も含む。
+func (p Polygon) Contains(c Coord) bool {
+	inside := false
+	for _, edge := range p.Edges() {
+		if edge.DistanceTo(c) < 1e-8 {
+			return true
+		}
+
+		// c から右へ伸ばした半直線と辺が交わる回数の偶奇で判定する
+		a, b := edge.A, edge.B
+		if (a.Y > c.Y) != (b.Y > c.Y) {
+			x := a.X + (c.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y)
+			if c.X < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// 線分 s が多角形の辺と交わるか (接する場合を含む) を返す。
+func (p Polygon) IntersectsSegment(s Segment) bool {
+	for _, edge := range p.Edges() {
+		if _, ok := edge.Intersection(s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package geom
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func c(a, b float64) Coord {
 	return NewCoord(a, b)
@@ -53,3 +56,354 @@ func TestSegmentCrosses(t *testing.T) {
 		}
 	})
 }
+
+func TestVector(t *testing.T) {
+	t.Run("Dot", func(t *testing.T) {
+		testcases := []struct {
+			a, b     Vector
+			expected float64
+		}{
+			{NewVector(1, 0), NewVector(0, 1), 0},
+			{NewVector(1, 2), NewVector(3, 4), 11},
+			{NewVector(1, 1), NewVector(-1, -1), -2},
+		}
+
+		for _, tc := range testcases {
+			if dot := tc.a.Dot(tc.b); !eq(dot, tc.expected) {
+				t.Fatalf(
+					"Wrong dot: %v and %v: expected %v but %v",
+					tc.a, tc.b, tc.expected, dot,
+				)
+			}
+		}
+	})
+
+	t.Run("Normalize", func(t *testing.T) {
+		testcases := []struct {
+			v, expected Vector
+		}{
+			{NewVector(3, 4), NewVector(0.6, 0.8)},
+			{NewVector(0, -2), NewVector(0, -1)},
+			{NewVector(0, 0), NewVector(0, 0)},
+		}
+
+		for _, tc := range testcases {
+			if n := tc.v.Normalize(); !veq(n, tc.expected) {
+				t.Fatalf(
+					"Wrong normalize: %v: expected %v but %v",
+					tc.v, tc.expected, n,
+				)
+			}
+		}
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		testcases := []struct {
+			v        Vector
+			t        float64
+			expected Vector
+		}{
+			{NewVector(1, 0), math.Pi / 2, NewVector(0, 1)},
+			{NewVector(1, 0), -math.Pi / 2, NewVector(0, -1)},
+			{NewVector(1, 1), math.Pi, NewVector(-1, -1)},
+			{NewVector(2, 0), math.Pi / 4, NewVector(math.Sqrt2, math.Sqrt2)},
+		}
+
+		for _, tc := range testcases {
+			if r := tc.v.Rotate(tc.t); !veq(r, tc.expected) {
+				t.Fatalf(
+					"Wrong rotate: %v by %v: expected %v but %v",
+					tc.v, tc.t, tc.expected, r,
+				)
+			}
+		}
+	})
+
+	t.Run("AngleTo", func(t *testing.T) {
+		testcases := []struct {
+			a, b     Vector
+			expected float64
+		}{
+			{NewVector(1, 0), NewVector(0, 1), math.Pi / 2},
+			{NewVector(0, 1), NewVector(1, 0), -math.Pi / 2},
+			{NewVector(1, 0), NewVector(-1, 0), math.Pi},
+			{NewVector(1, 1), NewVector(2, 2), 0},
+			{NewVector(0, 0), NewVector(1, 0), 0},
+		}
+
+		for _, tc := range testcases {
+			if angle := tc.a.AngleTo(tc.b); !eq(angle, tc.expected) {
+				t.Fatalf(
+					"Wrong angle: %v to %v: expected %v but %v",
+					tc.a, tc.b, tc.expected, angle,
+				)
+			}
+		}
+	})
+
+	t.Run("Distance", func(t *testing.T) {
+		testcases := []struct {
+			a, b     Coord
+			expected float64
+		}{
+			{c(0, 0), c(3, 4), 5},
+			{c(-1, -1), c(-1, -1), 0},
+			{c(1, 0), c(-1, 0), 2},
+		}
+
+		for _, tc := range testcases {
+			if d := tc.a.DistanceTo(tc.b); !eq(d, tc.expected) {
+				t.Fatalf(
+					"Wrong distance: %v and %v: expected %v but %v",
+					tc.a, tc.b, tc.expected, d,
+				)
+			}
+		}
+	})
+}
+
+func TestAngle(t *testing.T) {
+	t.Run("NormalizeAngle", func(t *testing.T) {
+		testcases := []struct {
+			t, expected float64
+		}{
+			{0, 0},
+			{math.Pi, math.Pi},
+			{-math.Pi, math.Pi},
+			{3 * math.Pi / 2, -math.Pi / 2},
+			{-3 * math.Pi / 2, math.Pi / 2},
+			{5 * math.Pi, math.Pi},
+			{4*math.Pi + 0.5, 0.5},
+		}
+
+		for _, tc := range testcases {
+			if n := NormalizeAngle(tc.t); !eq(n, tc.expected) {
+				t.Fatalf(
+					"Wrong normalized angle: %v: expected %v but %v",
+					tc.t, tc.expected, n,
+				)
+			}
+		}
+	})
+
+	t.Run("PolarNormalize", func(t *testing.T) {
+		testcases := []struct {
+			p, expected PolarVector
+		}{
+			{NewPolarVector(1, 2*math.Pi), NewPolarVector(1, 0)},
+			{NewPolarVector(-1, 0), NewPolarVector(1, math.Pi)},
+			{NewPolarVector(-2, math.Pi/2), NewPolarVector(2, -math.Pi/2)},
+		}
+
+		for _, tc := range testcases {
+			n := tc.p.Normalize()
+			if !eq(n.R, tc.expected.R) || !eq(n.T, tc.expected.T) {
+				t.Fatalf(
+					"Wrong normalized polar: %v: expected %v but %v",
+					tc.p, tc.expected, n,
+				)
+			}
+		}
+	})
+}
+
+func TestRect(t *testing.T) {
+	r := NewRectFromPoints(-1, -2, 3, 4)
+
+	t.Run("Size", func(t *testing.T) {
+		if !eq(r.Width(), 4) || !eq(r.Height(), 6) {
+			t.Fatalf("Wrong size: %v: %v x %v", r, r.Width(), r.Height())
+		}
+	})
+
+	t.Run("Center", func(t *testing.T) {
+		if center := r.Center(); !veq(center.Vector, NewVector(1, 1)) {
+			t.Fatalf("Wrong center: %v: %v", r, center)
+		}
+	})
+
+	t.Run("Contains", func(t *testing.T) {
+		testcases := []struct {
+			p        Coord
+			expected bool
+		}{
+			{c(0, 0), true},
+			{c(-1, -2), true},
+			{c(3, 4), true},
+			{c(3.1, 0), false},
+			{c(0, -2.1), false},
+		}
+
+		for _, tc := range testcases {
+			if contains := r.Contains(tc.p); contains != tc.expected {
+				t.Fatalf(
+					"Wrong contains: %v in %v: expected %v but %v",
+					tc.p, r, tc.expected, contains,
+				)
+			}
+		}
+	})
+
+	t.Run("Clamp", func(t *testing.T) {
+		testcases := []struct {
+			p, expected Coord
+		}{
+			{c(0, 0), c(0, 0)},
+			{c(5, 0), c(3, 0)},
+			{c(-5, -5), c(-1, -2)},
+			{c(2, 10), c(2, 4)},
+		}
+
+		for _, tc := range testcases {
+			if clamped := r.Clamp(tc.p); !veq(clamped.Vector, tc.expected.Vector) {
+				t.Fatalf(
+					"Wrong clamp: %v in %v: expected %v but %v",
+					tc.p, r, tc.expected, clamped,
+				)
+			}
+		}
+	})
+}
+
+func TestSegment(t *testing.T) {
+	t.Run("ClosestPoint", func(t *testing.T) {
+		testcases := []struct {
+			s           Segment
+			p, expected Coord
+		}{
+			{s(c(0, 0), c(2, 0)), c(1, 1), c(1, 0)},
+			{s(c(0, 0), c(2, 0)), c(-1, 1), c(0, 0)},
+			{s(c(0, 0), c(2, 0)), c(5, -1), c(2, 0)},
+			{s(c(0, 0), c(2, 2)), c(2, 0), c(1, 1)},
+			{s(c(1, 1), c(1, 1)), c(0, 0), c(1, 1)},
+		}
+
+		for _, tc := range testcases {
+			if closest := tc.s.ClosestPoint(tc.p); !veq(closest.Vector, tc.expected.Vector) {
+				t.Fatalf(
+					"Wrong closest point: %v to %v: expected %v but %v",
+					tc.p, tc.s, tc.expected, closest,
+				)
+			}
+		}
+	})
+
+	t.Run("DistanceTo", func(t *testing.T) {
+		testcases := []struct {
+			s        Segment
+			p        Coord
+			expected float64
+		}{
+			{s(c(0, 0), c(2, 0)), c(1, 1), 1},
+			{s(c(0, 0), c(2, 0)), c(5, 4), 5},
+			{s(c(0, 0), c(2, 0)), c(1, 0), 0},
+		}
+
+		for _, tc := range testcases {
+			if d := tc.s.DistanceTo(tc.p); !eq(d, tc.expected) {
+				t.Fatalf(
+					"Wrong distance: %v to %v: expected %v but %v",
+					tc.p, tc.s, tc.expected, d,
+				)
+			}
+		}
+	})
+
+	t.Run("Intersection", func(t *testing.T) {
+		testcases := []struct {
+			a, b     Segment
+			ok       bool
+			expected Coord
+		}{
+			{s(c(1, -1), c(1, 1)), s(c(0, 0), c(2, 0)), true, c(1, 0)},
+			{s(c(0, 0), c(2, 2)), s(c(0, 2), c(2, 0)), true, c(1, 1)},
+			// 端点で接する
+			{s(c(1, 0), c(1, 1)), s(c(0, 0), c(2, 0)), true, c(1, 0)},
+			{s(c(1, 0), c(1, 1)), s(c(0, -1), c(2, -1)), false, c(0, 0)},
+			// 平行
+			{s(c(0, 0), c(1, 0)), s(c(0, 1), c(1, 1)), false, c(0, 0)},
+		}
+
+		for _, tc := range testcases {
+			p, ok := tc.a.Intersection(tc.b)
+			if ok != tc.ok || (ok && !veq(p.Vector, tc.expected.Vector)) {
+				t.Fatalf(
+					"Wrong intersection: %v and %v: expected %v (%v) but %v (%v)",
+					tc.a, tc.b, tc.expected, tc.ok, p, ok,
+				)
+			}
+		}
+	})
+}
+
+func eq(a, b float64) bool {
+	return math.Abs(a-b) < 1e-8
+}
+
+func veq(a, b Vector) bool {
+	return eq(a.X, b.X) && eq(a.Y, b.Y)
+}
+
+func TestPolygon(t *testing.T) {
+	// 凹んだ多角形
+	//
+	//  +--+  +--+
+	//  |  |  |  |
+	//  |  +--+  |
+	//  |        |
+	//  +--------+
+	p := NewPolygon(c(0, 0), c(3, 0), c(3, 3), c(2, 3), c(2, 1), c(1, 1), c(1, 3), c(0, 3))
+
+	t.Run("Contains", func(t *testing.T) {
+		testcases := []struct {
+			p        Coord
+			expected bool
+		}{
+			{c(0.5, 0.5), true},
+			{c(0.5, 2.5), true},
+			{c(2.5, 2.5), true},
+			{c(1.5, 2), false},
+			{c(1.5, 1), true},
+			{c(0, 0), true},
+			{c(4, 0.5), false},
+			{c(-1, 0.5), false},
+		}
+
+		for _, tc := range testcases {
+			if contains := p.Contains(tc.p); contains != tc.expected {
+				t.Fatalf(
+					"Wrong contains: %v: expected %v but %v",
+					tc.p, tc.expected, contains,
+				)
+			}
+		}
+	})
+
+	t.Run("IntersectsSegment", func(t *testing.T) {
+		testcases := []struct {
+			s        Segment
+			expected bool
+		}{
+			{s(c(-1, 0.5), c(0.5, 0.5)), true},
+			{s(c(0.5, 0.5), c(2.5, 0.5)), false},
+			{s(c(0.5, 2), c(2.5, 2)), true},
+			{s(c(-1, -1), c(-1, 4)), false},
+		}
+
+		for _, tc := range testcases {
+			if intersects := p.IntersectsSegment(tc.s); intersects != tc.expected {
+				t.Fatalf(
+					"Wrong intersects: %v: expected %v but %v",
+					tc.s, tc.expected, intersects,
+				)
+			}
+		}
+	})
+
+	t.Run("FromRect", func(t *testing.T) {
+		r := NewPolygonFromRect(NewRectFromPoints(-1, -1, 1, 1))
+		if !r.Contains(c(0, 0)) || !r.Contains(c(1, 1)) || r.Contains(c(1.5, 0)) {
+			t.Fatalf("Wrong polygon from rect: %v", r)
+		}
+	})
+}
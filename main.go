@@ -20,7 +20,7 @@ func (ai *constAI) Init(config game.GameConfig) error {
 func (ai *constAI) Think(
 	knowledge game.Knowledge,
 	agent game.Agent,
-) (*game.ActionMove, error) {
+) (game.Action, error) {
 	return &game.ActionMove{Dir: ai.Dir}, nil
 }
 
@@ -63,5 +63,9 @@ func createAIPlay() aiplay.AIPlay {
 		)
 	}
 
-	return config.BuildAIPlay()
+	play, err := config.BuildAIPlay()
+	if err != nil {
+		panic(err)
+	}
+	return play
 }
@@ -0,0 +1,202 @@
+package mapgen
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+type Style int
+
+const (
+	// 格子の辺にランダムに壁を置く
+	StyleRandomWalls Style = iota
+	// 部屋を通路でつなぐ。部屋と通路の外は立ち入り禁止になる。
+	StyleRooms
+	// 迷路。Density が低いほど迷路の壁が間引かれて抜け道が増える。
+	StyleMaze
+	// 格子のセルの中央に小さな柱を置く
+	StylePillars
+)
+
+type Symmetry int
+
+const (
+	SymmetryNone Symmetry = iota
+	// 左右対称
+	SymmetryMirror
+	// 中心について 180 度回転しても同じ
+	SymmetryRotate2
+	// 中心について 90 度回転しても同じ (正方形のフィールドのみ)
+	SymmetryRotate4
+)
+
+func (s Symmetry) String() string {
+	switch s {
+	case SymmetryNone:
+		return "none"
+	case SymmetryMirror:
+		return "mirror"
+	case SymmetryRotate2:
+		return "rotate2"
+	case SymmetryRotate4:
+		return "rotate4"
+	default:
+		return fmt.Sprintf("Symmetry(%d)", int(s))
+	}
+}
+
+// 対称性で互いに移り合う位置の数
+func (s Symmetry) Order() int {
+	switch s {
+	case SymmetryMirror, SymmetryRotate2:
+		return 2
+	case SymmetryRotate4:
+		return 4
+	default:
+		return 1
+	}
+}
+
+func (s Style) String() string {
+	switch s {
+	case StyleRandomWalls:
+		return "random-walls"
+	case StyleRooms:
+		return "rooms"
+	case StyleMaze:
+		return "maze"
+	case StylePillars:
+		return "pillars"
+	default:
+		return fmt.Sprintf("Style(%d)", int(s))
+	}
+}
+
+// フィールドを Cols x Rows の格子に区切り、その上に壁や部屋を配置する。
+type Config struct {
+	Rect  geom.Rect
+	Cols  int
+	Rows  int
+	Style Style
+	// 壁や柱の多さ (部屋の場合は部屋が占める割合) 。0 から 1 まで。
+	Density float64
+	// 壁が視線だけでなく移動も遮るか
+	Solid bool
+	// 壁や部屋の配置の対称性
+	Symmetry Symmetry
+	// 出現する領域を割り当てる Squad の名前。空でなければ、対称性で互いに
+	// 移り合う領域を一つずつ割り当てる。数は Symmetry.Order() を割り切れな
+	// ければならない。
+	Squads []string
+	// 乱数の種。同じ種なら同じマップになる。
+	Seed int64
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Rect:    geom.NewRectFromPoints(-50.0, -50.0, 50.0, 50.0),
+		Cols:    10,
+		Rows:    10,
+		Style:   StyleRandomWalls,
+		Density: 0.3,
+		Solid:   true,
+
+		Symmetry: SymmetryNone,
+		Squads:   []string{},
+
+		Seed: 0,
+	}
+}
+
+func (c *Config) WithRect(rect geom.Rect) *Config {
+	c.Rect = rect
+	return c
+}
+
+func (c *Config) WithGrid(cols, rows int) *Config {
+	c.Cols = cols
+	c.Rows = rows
+	return c
+}
+
+func (c *Config) WithStyle(style Style) *Config {
+	c.Style = style
+	return c
+}
+
+func (c *Config) WithDensity(density float64) *Config {
+	c.Density = density
+	return c
+}
+
+func (c *Config) WithSolid(solid bool) *Config {
+	c.Solid = solid
+	return c
+}
+
+func (c *Config) WithSymmetry(symmetry Symmetry) *Config {
+	c.Symmetry = symmetry
+	return c
+}
+
+func (c *Config) WithSquads(names ...string) *Config {
+	c.Squads = append([]string{}, names...)
+	return c
+}
+
+func (c *Config) WithSeed(seed int64) *Config {
+	c.Seed = seed
+	return c
+}
+
+func (c *Config) Clone() Config {
+	cloned := *c
+	cloned.Squads = append([]string{}, c.Squads...)
+	return cloned
+}
+
+func (c *Config) Validate() (errs error) {
+	if c.Rect.Width() <= 0 || c.Rect.Height() <= 0 {
+		errs = multierror.Append(errs, fmt.Errorf("empty rect: %v", c.Rect))
+	}
+
+	if c.Cols <= 0 || c.Rows <= 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"invalid grid size: %dx%d", c.Cols, c.Rows,
+		))
+	}
+
+	if c.Style < StyleRandomWalls || StylePillars < c.Style {
+		errs = multierror.Append(errs, fmt.Errorf("unknown style: %d", c.Style))
+	}
+
+	if c.Density < 0 || 1 < c.Density {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"density out of range: %f", c.Density,
+		))
+	}
+
+	if c.Symmetry < SymmetryNone || SymmetryRotate4 < c.Symmetry {
+		errs = multierror.Append(errs, fmt.Errorf("unknown symmetry: %d", c.Symmetry))
+	}
+
+	if c.Symmetry == SymmetryRotate4 &&
+		(c.Cols != c.Rows || math.Abs(c.Rect.Width()-c.Rect.Height()) > 1e-9) {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"%v symmetry requires square field and grid: %dx%d in %v",
+			c.Symmetry, c.Cols, c.Rows, c.Rect,
+		))
+	}
+
+	if len(c.Squads) > 0 && c.Symmetry.Order()%len(c.Squads) != 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"%d squads cannot share %v symmetry of order %d",
+			len(c.Squads), c.Symmetry, c.Symmetry.Order(),
+		))
+	}
+
+	return
+}
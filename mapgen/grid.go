@@ -0,0 +1,215 @@
+package mapgen
+
+import (
+	"math/rand"
+)
+
+// セルの格子。壁は隣り合うセルの間の辺に置かれる。
+type grid struct {
+	cols, rows int
+	// east[y][x]: セル (x, y) と (x+1, y) の間に壁があるか
+	east [][]bool
+	// south[y][x]: セル (x, y) と (x, y+1) の間に壁があるか
+	south [][]bool
+	// 部屋の外のように立ち入れないセル
+	blocked [][]bool
+	// pillars[y][x]: セル (x, y) と (x+1, y+1) の間の格子点に柱があるか
+	pillars [][]bool
+	// Config.Squads の順に並んだ、それぞれの Squad の出現するセル
+	spawns []cell
+}
+
+type cell struct {
+	x, y int
+}
+
+// 隣り合うセルの間の辺。East なら (X, Y) と (X+1, Y) 、そうでなければ
+// (X, Y) と (X, Y+1) の間。
+type edge struct {
+	X, Y int
+	East bool
+}
+
+func newGrid(cols, rows int) *grid {
+	return &grid{
+		cols:    cols,
+		rows:    rows,
+		east:    newCells(cols, rows),
+		south:   newCells(cols, rows),
+		blocked: newCells(cols, rows),
+		pillars: newCells(cols, rows),
+		spawns:  []cell{},
+	}
+}
+
+func newCells(cols, rows int) [][]bool {
+	cells := make([][]bool, rows)
+	for y := range cells {
+		cells[y] = make([]bool, cols)
+	}
+	return cells
+}
+
+func (e edge) cells() (x1, y1, x2, y2 int) {
+	if e.East {
+		return e.X, e.Y, e.X + 1, e.Y
+	}
+	return e.X, e.Y, e.X, e.Y + 1
+}
+
+// 内側の辺をすべて返す。
+func (g *grid) edges() []edge {
+	edges := []edge{}
+	for y := 0; y < g.rows; y++ {
+		for x := 0; x < g.cols; x++ {
+			if x+1 < g.cols {
+				edges = append(edges, edge{X: x, Y: y, East: true})
+			}
+			if y+1 < g.rows {
+				edges = append(edges, edge{X: x, Y: y, East: false})
+			}
+		}
+	}
+	return edges
+}
+
+func (g *grid) hasWall(e edge) bool {
+	if e.East {
+		return g.east[e.Y][e.X]
+	}
+	return g.south[e.Y][e.X]
+}
+
+func (g *grid) setWall(e edge, wall bool) {
+	if e.East {
+		g.east[e.Y][e.X] = wall
+	} else {
+		g.south[e.Y][e.X] = wall
+	}
+}
+
+// 両側のセルに立ち入れる辺か
+func (g *grid) isOpenEdge(e edge) bool {
+	x1, y1, x2, y2 := e.cells()
+	return !g.blocked[y1][x1] && !g.blocked[y2][x2]
+}
+
+func (g *grid) setAllWalls(wall bool) {
+	for _, e := range g.edges() {
+		g.setWall(e, wall)
+	}
+}
+
+// 立ち入れるセルと立ち入れないセルの境目に壁を置く。
+func (g *grid) sealBlocked() {
+	for _, e := range g.edges() {
+		x1, y1, x2, y2 := e.cells()
+		if g.blocked[y1][x1] != g.blocked[y2][x2] {
+			g.setWall(e, true)
+		}
+	}
+}
+
+func (g *grid) openCells() int {
+	count := 0
+	for y := 0; y < g.rows; y++ {
+		for x := 0; x < g.cols; x++ {
+			if !g.blocked[y][x] {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// 立ち入れるセルが壁を越えずに互いに行き来できるまとまりの数を返す。
+func (g *grid) components() int {
+	uf := newUnionFind(g.cols * g.rows)
+	for _, e := range g.edges() {
+		if g.isOpenEdge(e) && !g.hasWall(e) {
+			uf.union(g.index(e.cells()))
+		}
+	}
+
+	roots := map[int]bool{}
+	for y := 0; y < g.rows; y++ {
+		for x := 0; x < g.cols; x++ {
+			if !g.blocked[y][x] {
+				roots[uf.find(x+y*g.cols)] = true
+			}
+		}
+	}
+	return len(roots)
+}
+
+// 立ち入れるセルがすべてつながるまで、ランダムな順に壁を取り除く。つながり
+// を増やさない壁は残す。対称性を崩さないよう、移り合う壁はまとめて取り除く。
+func (g *grid) connect(rng *rand.Rand, s *symmetry) {
+	uf := newUnionFind(g.cols * g.rows)
+	walls := []edge{}
+	for _, e := range g.edges() {
+		if !g.isOpenEdge(e) {
+			continue
+		}
+
+		if !g.hasWall(e) {
+			uf.union(g.index(e.cells()))
+		} else if s.canonical(edgePoint(e)) == edgePoint(e) {
+			walls = append(walls, e)
+		}
+	}
+
+	rng.Shuffle(len(walls), func(i, j int) {
+		walls[i], walls[j] = walls[j], walls[i]
+	})
+
+	for _, wall := range walls {
+		joined := false
+		orbit := s.orbit(edgePoint(wall))
+		for _, p := range orbit {
+			if uf.union(g.index(p.edge().cells())) {
+				joined = true
+			}
+		}
+
+		if joined {
+			for _, p := range orbit {
+				g.setWall(p.edge(), false)
+			}
+		}
+	}
+}
+
+func (g *grid) index(x1, y1, x2, y2 int) (int, int) {
+	return x1 + y1*g.cols, x2 + y2*g.cols
+}
+
+type unionFind struct {
+	parents []int
+}
+
+func newUnionFind(n int) *unionFind {
+	parents := make([]int, n)
+	for idx := range parents {
+		parents[idx] = idx
+	}
+	return &unionFind{parents: parents}
+}
+
+func (uf *unionFind) find(x int) int {
+	for uf.parents[x] != x {
+		uf.parents[x] = uf.parents[uf.parents[x]]
+		x = uf.parents[x]
+	}
+	return x
+}
+
+// a と b を同じまとまりにする。もともと別のまとまりだったかを返す。
+func (uf *unionFind) union(a, b int) bool {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra == rb {
+		return false
+	}
+	uf.parents[ra] = rb
+	return true
+}
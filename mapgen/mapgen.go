@@ -0,0 +1,333 @@
+// 種からフィールドを生成する。
+//
+// フィールドを格子に区切り、格子の辺に壁を、格子点に柱を置く。どのスタイル
+// でも、立ち入れるセルは壁を越えずに互いに行き来できることが保証される。
+//
+// Symmetry を指定すると、壁や部屋が対称に配置され、Squad ごとの出現する領
+// 域も互いに移り合う位置に置かれる。
+package mapgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/statiolake/witness-counting-game/game"
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+// 柱の一辺の長さの、セルの短い方の辺の長さに対する割合
+const pillarRatio = 0.4
+
+// 出現する領域をセルの辺から離す幅の、セルの短い方の辺の長さに対する割合
+const spawnMarginRatio = 0.1
+
+func Generate(c *Config) (*game.FieldConfig, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := generateGrid(c)
+	if len(g.spawns) != len(c.Squads) {
+		return nil, fmt.Errorf(
+			"no cell for %d squads in %dx%d grid with %v symmetry",
+			len(c.Squads), c.Cols, c.Rows, c.Symmetry,
+		)
+	}
+
+	return g.toFieldConfig(c), nil
+}
+
+// まずスタイルに従って格子全体を作り、それを対称にしてから、つながるよう
+// に壁を取り除く。
+func generateGrid(c *Config) *grid {
+	rng := rand.New(rand.NewSource(c.Seed))
+	sym := newSymmetry(c.Symmetry, c.Cols, c.Rows)
+	g := newGrid(c.Cols, c.Rows)
+
+	switch c.Style {
+	case StyleRandomWalls:
+		g.randomWalls(rng, c.Density)
+	case StyleRooms:
+		rooms := g.rooms(rng, c.Density)
+		if c.Symmetry != SymmetryNone {
+			g.carveToCenter(rooms[0])
+		}
+	case StyleMaze:
+		g.maze(rng, c.Density)
+	case StylePillars:
+		g.scatterPillars(rng, c.Density)
+	}
+
+	g.symmetrize(sym)
+	g.sealBlocked()
+	g.connect(rng, sym)
+	g.spawns = g.chooseSpawns(rng, sym, len(c.Squads))
+	return g
+}
+
+func (g *grid) randomWalls(rng *rand.Rand, density float64) {
+	for _, e := range g.edges() {
+		g.setWall(e, rng.Float64() < density)
+	}
+}
+
+// 穴掘り法で完全迷路を作ってから、壁を 1 - density の確率で取り除く。
+func (g *grid) maze(rng *rand.Rand, density float64) {
+	g.setAllWalls(true)
+
+	visited := newCells(g.cols, g.rows)
+	start := cell{rng.Intn(g.cols), rng.Intn(g.rows)}
+	visited[start.y][start.x] = true
+	stack := []cell{start}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+
+		nexts := []edge{}
+		for _, e := range g.edgesAround(cur.x, cur.y) {
+			x1, y1, x2, y2 := e.cells()
+			if !visited[y1][x1] || !visited[y2][x2] {
+				nexts = append(nexts, e)
+			}
+		}
+
+		if len(nexts) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		e := nexts[rng.Intn(len(nexts))]
+		g.setWall(e, false)
+		x1, y1, x2, y2 := e.cells()
+		next := cell{x1, y1}
+		if visited[y1][x1] {
+			next = cell{x2, y2}
+		}
+		visited[next.y][next.x] = true
+		stack = append(stack, next)
+	}
+
+	for _, e := range g.edges() {
+		if g.hasWall(e) && rng.Float64() >= density {
+			g.setWall(e, false)
+		}
+	}
+}
+
+// セル (x, y) に接する内側の辺を返す。
+func (g *grid) edgesAround(x, y int) []edge {
+	edges := []edge{}
+	if x > 0 {
+		edges = append(edges, edge{X: x - 1, Y: y, East: true})
+	}
+	if x+1 < g.cols {
+		edges = append(edges, edge{X: x, Y: y, East: true})
+	}
+	if y > 0 {
+		edges = append(edges, edge{X: x, Y: y - 1, East: false})
+	}
+	if y+1 < g.rows {
+		edges = append(edges, edge{X: x, Y: y, East: false})
+	}
+	return edges
+}
+
+type room struct {
+	x, y, w, h int
+}
+
+func (r room) center() (int, int) {
+	return r.x + r.w/2, r.y + r.h/2
+}
+
+// 間に 1 セル以上の隙間がなければ重なっているとみなす。
+func (r room) overlaps(other room) bool {
+	return r.x <= other.x+other.w && other.x <= r.x+r.w &&
+		r.y <= other.y+other.h && other.y <= r.y+r.h
+}
+
+// 部屋の占めるセルの割合が density に達するまで部屋を置き、置いた順に通路で
+// つなぐ。部屋と通路の外は立ち入れなくなる。置いた部屋を返す。
+func (g *grid) rooms(rng *rand.Rand, density float64) []room {
+	for y := 0; y < g.rows; y++ {
+		for x := 0; x < g.cols; x++ {
+			g.blocked[y][x] = true
+		}
+	}
+
+	maxW := maxInt(1, g.cols/3)
+	maxH := maxInt(1, g.rows/3)
+	target := int(math.Ceil(density * float64(g.cols*g.rows)))
+	covered := 0
+	rooms := []room{}
+	for attempt := 0; attempt < 100*g.cols*g.rows; attempt++ {
+		if len(rooms) > 0 && covered >= target {
+			break
+		}
+
+		w, h := 1+rng.Intn(maxW), 1+rng.Intn(maxH)
+		r := room{
+			x: rng.Intn(g.cols - w + 1),
+			y: rng.Intn(g.rows - h + 1),
+			w: w,
+			h: h,
+		}
+
+		overlapped := false
+		for _, other := range rooms {
+			if r.overlaps(other) {
+				overlapped = true
+				break
+			}
+		}
+		if overlapped {
+			continue
+		}
+
+		for y := r.y; y < r.y+r.h; y++ {
+			for x := r.x; x < r.x+r.w; x++ {
+				g.blocked[y][x] = false
+			}
+		}
+		covered += r.w * r.h
+		rooms = append(rooms, r)
+	}
+
+	for idx := 1; idx < len(rooms); idx++ {
+		x1, y1 := rooms[idx-1].center()
+		x2, y2 := rooms[idx].center()
+		if rng.Intn(2) == 0 {
+			g.carveRow(y1, x1, x2)
+			g.carveCol(x2, y1, y2)
+		} else {
+			g.carveCol(x1, y1, y2)
+			g.carveRow(y2, x1, x2)
+		}
+	}
+
+	return rooms
+}
+
+func (g *grid) carveRow(y, x1, x2 int) {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	for x := x1; x <= x2; x++ {
+		g.blocked[y][x] = false
+	}
+}
+
+func (g *grid) carveCol(x, y1, y2 int) {
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	for y := y1; y <= y2; y++ {
+		g.blocked[y][x] = false
+	}
+}
+
+// 内側の格子点に density の確率で柱を置く。柱は辺の中点をふさがないので、
+// 行き来を妨げることはない。
+func (g *grid) scatterPillars(rng *rand.Rand, density float64) {
+	for y := 0; y+1 < g.rows; y++ {
+		for x := 0; x+1 < g.cols; x++ {
+			g.pillars[y][x] = rng.Float64() < density
+		}
+	}
+}
+
+func (g *grid) toFieldConfig(c *Config) *game.FieldConfig {
+	field := game.DefaultFieldConfig().WithRect(c.Rect)
+	cw := c.Rect.Width() / float64(g.cols)
+	ch := c.Rect.Height() / float64(g.rows)
+	at := func(x, y float64) geom.Coord {
+		return geom.NewCoord(c.Rect.LT.X+x*cw, c.Rect.LT.Y+y*ch)
+	}
+
+	addWall := func(segment geom.Segment) {
+		obst := game.NewObstructionConfig(segment)
+		if c.Solid {
+			obst.WithSolid()
+		}
+		field.WithObstructionAdded(*obst)
+	}
+
+	// 一直線に並んだ壁はまとめて 1 本の線分にする
+	for x := 0; x+1 < g.cols; x++ {
+		start := -1
+		for y := 0; y <= g.rows; y++ {
+			wall := y < g.rows && g.east[y][x]
+			if wall && start < 0 {
+				start = y
+			} else if !wall && start >= 0 {
+				lineX := float64(x + 1)
+				addWall(geom.NewSegment(at(lineX, float64(start)), at(lineX, float64(y))))
+				start = -1
+			}
+		}
+	}
+
+	for y := 0; y+1 < g.rows; y++ {
+		start := -1
+		for x := 0; x <= g.cols; x++ {
+			wall := x < g.cols && g.south[y][x]
+			if wall && start < 0 {
+				start = x
+			} else if !wall && start >= 0 {
+				lineY := float64(y + 1)
+				addWall(geom.NewSegment(at(float64(start), lineY), at(float64(x), lineY)))
+				start = -1
+			}
+		}
+	}
+
+	half := pillarRatio / 2 * math.Min(cw, ch)
+	for y := 0; y+1 < g.rows; y++ {
+		for x := 0; x+1 < g.cols; x++ {
+			if !g.pillars[y][x] {
+				continue
+			}
+
+			p := at(float64(x+1), float64(y+1))
+			rect := geom.NewRectFromPoints(p.X-half, p.Y-half, p.X+half, p.Y+half)
+			for _, segment := range geom.NewPolygonFromRect(rect).Edges() {
+				addWall(segment)
+			}
+		}
+	}
+
+	spawnMargin := spawnMarginRatio * math.Min(cw, ch)
+	for idx, spawn := range g.spawns {
+		lt := at(float64(spawn.x), float64(spawn.y))
+		rb := at(float64(spawn.x+1), float64(spawn.y+1))
+		rect := geom.NewRectFromPoints(
+			lt.X+spawnMargin, lt.Y+spawnMargin, rb.X-spawnMargin, rb.Y-spawnMargin,
+		)
+		field.WithSpawnZoneAdded(game.NewSpawnZoneConfig(rect).ForSquad(c.Squads[idx]))
+	}
+
+	// 立ち入れないセルは行ごとにまとめて立ち入り禁止区域にする
+	for y := 0; y < g.rows; y++ {
+		start := -1
+		for x := 0; x <= g.cols; x++ {
+			blocked := x < g.cols && g.blocked[y][x]
+			if blocked && start < 0 {
+				start = x
+			} else if !blocked && start >= 0 {
+				lt, rb := at(float64(start), float64(y)), at(float64(x), float64(y+1))
+				polygon := geom.NewPolygonFromRect(geom.NewRect(lt, rb))
+				field.WithAreaAdded(game.NewAreaConfig(polygon).WithNoGo())
+				start = -1
+			}
+		}
+	}
+
+	return field
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,339 @@
+package mapgen
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/statiolake/witness-counting-game/game"
+	"github.com/statiolake/witness-counting-game/geom"
+)
+
+var allStyles = []Style{StyleRandomWalls, StyleRooms, StyleMaze, StylePillars}
+
+// 生成されたフィールドの形だけを見て、立ち入れるセルの中心どうしが壁を
+// 越えずにすべてつながっているかを確かめる。
+func fieldComponents(field *game.FieldConfig, cols, rows int) int {
+	cw := field.Rect.Width() / float64(cols)
+	ch := field.Rect.Height() / float64(rows)
+	center := func(x, y int) geom.Coord {
+		return geom.NewCoord(
+			field.Rect.LT.X+(float64(x)+0.5)*cw,
+			field.Rect.LT.Y+(float64(y)+0.5)*ch,
+		)
+	}
+
+	open := func(x, y int) bool {
+		for _, area := range field.Areas {
+			if area.NoGo && area.Polygon.Contains(center(x, y)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	passable := func(x1, y1, x2, y2 int) bool {
+		path := geom.NewSegment(center(x1, y1), center(x2, y2))
+		for _, obst := range field.Obsts {
+			if obst.Segment.Crosses(path) {
+				return false
+			}
+		}
+		return true
+	}
+
+	visited := newCells(cols, rows)
+	components := 0
+	for sy := 0; sy < rows; sy++ {
+		for sx := 0; sx < cols; sx++ {
+			if visited[sy][sx] || !open(sx, sy) {
+				continue
+			}
+
+			components++
+			visited[sy][sx] = true
+			queue := [][2]int{{sx, sy}}
+			for len(queue) > 0 {
+				x, y := queue[0][0], queue[0][1]
+				queue = queue[1:]
+				for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					nx, ny := x+d[0], y+d[1]
+					if nx < 0 || cols <= nx || ny < 0 || rows <= ny {
+						continue
+					}
+					if visited[ny][nx] || !open(nx, ny) || !passable(x, y, nx, ny) {
+						continue
+					}
+					visited[ny][nx] = true
+					queue = append(queue, [2]int{nx, ny})
+				}
+			}
+		}
+	}
+
+	return components
+}
+
+// world 座標での対称移動。symmetry.transforms と同じ順に並ぶ。
+func worldTransforms(s Symmetry, rect geom.Rect) []func(p geom.Coord) geom.Coord {
+	identity := func(p geom.Coord) geom.Coord { return p }
+	mirror := func(p geom.Coord) geom.Coord {
+		return geom.NewCoord(rect.LT.X+rect.RB.X-p.X, p.Y)
+	}
+	rotate90 := func(p geom.Coord) geom.Coord {
+		return geom.NewCoord(rect.LT.X+rect.RB.Y-p.Y, rect.LT.Y+p.X-rect.LT.X)
+	}
+	rotate180 := func(p geom.Coord) geom.Coord {
+		return geom.NewCoord(rect.LT.X+rect.RB.X-p.X, rect.LT.Y+rect.RB.Y-p.Y)
+	}
+
+	switch s {
+	case SymmetryMirror:
+		return []func(geom.Coord) geom.Coord{identity, mirror}
+	case SymmetryRotate2:
+		return []func(geom.Coord) geom.Coord{identity, rotate180}
+	case SymmetryRotate4:
+		rotate270 := func(p geom.Coord) geom.Coord { return rotate90(rotate180(p)) }
+		return []func(geom.Coord) geom.Coord{identity, rotate90, rotate180, rotate270}
+	default:
+		return []func(geom.Coord) geom.Coord{identity}
+	}
+}
+
+func coordKey(p geom.Coord) string {
+	round := func(v float64) float64 { return math.Round(v*1e6) / 1e6 }
+	return fmt.Sprintf("%.6f,%.6f", round(p.X), round(p.Y))
+}
+
+func segmentKey(s geom.Segment) string {
+	a, b := coordKey(s.A), coordKey(s.B)
+	if b < a {
+		a, b = b, a
+	}
+	return a + "-" + b
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("Connected", func(t *testing.T) {
+		for _, style := range allStyles {
+			for _, density := range []float64{0.0, 0.3, 0.7, 1.0} {
+				for seed := int64(0); seed < 20; seed++ {
+					c := DefaultConfig().
+						WithGrid(12, 8).
+						WithStyle(style).
+						WithDensity(density).
+						WithSeed(seed)
+					field, err := Generate(c)
+					if err != nil {
+						t.Fatalf("failed to generate: %v", err)
+					}
+
+					if n := fieldComponents(field, c.Cols, c.Rows); n != 1 {
+						t.Errorf(
+							"%v density %f seed %d: %d components",
+							style, density, seed, n,
+						)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		for _, style := range allStyles {
+			c := DefaultConfig().WithStyle(style).WithSeed(42)
+			a, _ := Generate(c)
+			b, _ := Generate(c)
+			if !reflect.DeepEqual(a, b) {
+				t.Errorf("%v: same seed generated different fields", style)
+			}
+
+			other, _ := Generate(DefaultConfig().WithStyle(style).WithSeed(43))
+			if reflect.DeepEqual(a, other) {
+				t.Errorf("%v: different seeds generated the same field", style)
+			}
+		}
+	})
+
+	t.Run("Density", func(t *testing.T) {
+		walls := func(density float64) int {
+			c := DefaultConfig().WithDensity(density).WithSeed(1)
+			g := generateGrid(c)
+			count := 0
+			for _, e := range g.edges() {
+				if g.hasWall(e) {
+					count++
+				}
+			}
+			return count
+		}
+
+		if sparse, dense := walls(0.1), walls(0.6); sparse >= dense {
+			t.Errorf("denser map has fewer walls: %d and %d", sparse, dense)
+		}
+
+		if n := walls(0.0); n != 0 {
+			t.Errorf("walls with zero density: %d", n)
+		}
+
+		rooms := func(density float64) int {
+			return generateGrid(DefaultConfig().
+				WithStyle(StyleRooms).
+				WithDensity(density).
+				WithSeed(1)).openCells()
+		}
+
+		if small, large := rooms(0.1), rooms(0.5); small >= large {
+			t.Errorf("denser rooms cover fewer cells: %d and %d", small, large)
+		}
+	})
+
+	t.Run("Maze", func(t *testing.T) {
+		// 完全迷路は全域木なので、壁のない辺はセル数 - 1 本になる
+		c := DefaultConfig().WithStyle(StyleMaze).WithDensity(1.0).WithGrid(9, 7)
+		g := generateGrid(c)
+		passages := 0
+		for _, e := range g.edges() {
+			if !g.hasWall(e) {
+				passages++
+			}
+		}
+
+		if passages != c.Cols*c.Rows-1 {
+			t.Errorf("maze is not perfect: %d passages", passages)
+		}
+	})
+
+	t.Run("Solid", func(t *testing.T) {
+		for _, solid := range []bool{false, true} {
+			field, _ := Generate(DefaultConfig().WithSolid(solid).WithDensity(0.5))
+			if len(field.Obsts) == 0 {
+				t.Fatalf("no obstructions generated")
+			}
+
+			for _, obst := range field.Obsts {
+				if obst.Solid != solid {
+					t.Errorf("obstruction solid is %v, expected %v", obst.Solid, solid)
+				}
+			}
+		}
+	})
+
+	t.Run("Playable", func(t *testing.T) {
+		for _, style := range allStyles {
+			field, _ := Generate(DefaultConfig().WithStyle(style).WithSeed(7))
+			config := game.DefaultGameConfig().WithFieldConfig(field)
+			if err := config.Validate(); err != nil {
+				t.Errorf("%v: generated field is invalid: %v", style, err)
+			}
+		}
+	})
+
+	t.Run("Symmetric", func(t *testing.T) {
+		symmetries := []Symmetry{SymmetryMirror, SymmetryRotate2, SymmetryRotate4}
+		for _, symmetry := range symmetries {
+			squads := []string{"squad-00", "squad-01", "squad-02", "squad-03"}[:symmetry.Order()]
+			for _, style := range allStyles {
+				for seed := int64(0); seed < 10; seed++ {
+					// 中央のセルがある奇数の格子とない偶数の格子を交互に試す
+					size := 9 + int(seed%2)
+					c := DefaultConfig().
+						WithGrid(size, size).
+						WithStyle(style).
+						WithSymmetry(symmetry).
+						WithSquads(squads...).
+						WithSeed(seed)
+					field, err := Generate(c)
+					if err != nil {
+						t.Fatalf("failed to generate: %v", err)
+					}
+
+					name := fmt.Sprintf("%v %v seed %d", symmetry, style, seed)
+					if n := fieldComponents(field, c.Cols, c.Rows); n != 1 {
+						t.Errorf("%s: %d components", name, n)
+					}
+
+					segments := map[string]bool{}
+					for _, obst := range field.Obsts {
+						segments[segmentKey(obst.Segment)] = true
+					}
+
+					transforms := worldTransforms(symmetry, field.Rect)
+					for _, transform := range transforms {
+						for _, obst := range field.Obsts {
+							image := geom.NewSegment(
+								transform(obst.Segment.A), transform(obst.Segment.B),
+							)
+							if !segments[segmentKey(image)] {
+								t.Fatalf("%s: %v has no symmetric pair", name, obst.Segment)
+							}
+						}
+					}
+
+					if len(field.SpawnZones) != len(squads) {
+						t.Fatalf("%s: %d spawn zones", name, len(field.SpawnZones))
+					}
+
+					base := field.SpawnZones[0].Rect.Center()
+					for idx, zone := range field.SpawnZones {
+						if zone.Squad != squads[idx] {
+							t.Errorf("%s: zone %d is for %s", name, idx, zone.Squad)
+						}
+
+						expected := coordKey(transforms[idx](base))
+						if actual := coordKey(zone.Rect.Center()); actual != expected {
+							t.Errorf(
+								"%s: zone %d is at %s, expected %s",
+								name, idx, actual, expected,
+							)
+						}
+
+						for _, area := range field.Areas {
+							if area.NoGo && area.Polygon.Contains(zone.Rect.Center()) {
+								t.Errorf("%s: zone %d is in no-go area", name, idx)
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("SpawnsForFewerSquads", func(t *testing.T) {
+		// 4 回対称で 2 Squad なら向かい合う位置に出現する
+		c := DefaultConfig().
+			WithSymmetry(SymmetryRotate4).
+			WithSquads("squad-00", "squad-01")
+		field, err := Generate(c)
+		if err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+
+		rotate180 := worldTransforms(SymmetryRotate2, field.Rect)[1]
+		a, b := field.SpawnZones[0].Rect.Center(), field.SpawnZones[1].Rect.Center()
+		if coordKey(rotate180(a)) != coordKey(b) {
+			t.Errorf("spawn zones are not opposite: %v and %v", a, b)
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		invalids := []*Config{
+			DefaultConfig().WithSymmetry(SymmetryRotate4).WithGrid(10, 8),
+			DefaultConfig().WithSymmetry(SymmetryMirror).WithSquads("a", "b", "c"),
+			DefaultConfig().WithSquads("a", "b"),
+			DefaultConfig().WithSymmetry(Symmetry(100)),
+			DefaultConfig().WithGrid(1, 1).WithSymmetry(SymmetryMirror).WithSquads("a", "b"),
+			DefaultConfig().WithGrid(0, 5),
+			DefaultConfig().WithDensity(1.5),
+			DefaultConfig().WithStyle(Style(100)),
+			DefaultConfig().WithRect(geom.NewRectFromPoints(0, 0, 0, 10)),
+		}
+
+		for _, c := range invalids {
+			if _, err := Generate(c); err == nil {
+				t.Errorf("invalid config accepted: %+v", c)
+			}
+		}
+	})
+}
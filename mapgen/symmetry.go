@@ -0,0 +1,199 @@
+package mapgen
+
+import (
+	"math"
+	"math/rand"
+)
+
+// 格子の位置を 2 倍した座標で表す。セル (x, y) は (2x+1, 2y+1) 、その東の
+// 辺は (2x+2, 2y+1) 、南の辺は (2x+1, 2y+2) 、南東の格子点は (2x+2, 2y+2)
+// となり、対称移動をすべて整数で扱える。
+type point struct {
+	a, b int
+}
+
+func cellPoint(x, y int) point {
+	return point{2*x + 1, 2*y + 1}
+}
+
+func edgePoint(e edge) point {
+	if e.East {
+		return point{2*e.X + 2, 2*e.Y + 1}
+	}
+	return point{2*e.X + 1, 2*e.Y + 2}
+}
+
+func pillarPoint(x, y int) point {
+	return point{2*x + 2, 2*y + 2}
+}
+
+func (p point) cell() (int, int) {
+	return (p.a - 1) / 2, (p.b - 1) / 2
+}
+
+func (p point) edge() edge {
+	if p.a%2 == 0 {
+		return edge{X: p.a/2 - 1, Y: (p.b - 1) / 2, East: true}
+	}
+	return edge{X: (p.a - 1) / 2, Y: p.b/2 - 1, East: false}
+}
+
+func (p point) pillar() (int, int) {
+	return p.a/2 - 1, p.b/2 - 1
+}
+
+func (p point) less(other point) bool {
+	return p.b < other.b || (p.b == other.b && p.a < other.a)
+}
+
+// 対称性をなす移動の一覧。最初は恒等移動で、SymmetryRotate4 では 90 度ずつ
+// 回転した順に並ぶ。
+type symmetry struct {
+	transforms []func(p point) point
+}
+
+func newSymmetry(s Symmetry, cols, rows int) *symmetry {
+	w, h := 2*cols, 2*rows
+	identity := func(p point) point { return p }
+	mirror := func(p point) point { return point{w - p.a, p.b} }
+	rotate90 := func(p point) point { return point{w - p.b, p.a} }
+	rotate180 := func(p point) point { return point{w - p.a, h - p.b} }
+	rotate270 := func(p point) point { return point{p.b, h - p.a} }
+
+	switch s {
+	case SymmetryMirror:
+		return &symmetry{[]func(point) point{identity, mirror}}
+	case SymmetryRotate2:
+		return &symmetry{[]func(point) point{identity, rotate180}}
+	case SymmetryRotate4:
+		return &symmetry{[]func(point) point{identity, rotate90, rotate180, rotate270}}
+	default:
+		return &symmetry{[]func(point) point{identity}}
+	}
+}
+
+// p が移り合う位置をすべて返す (重複を含むことがある) 。
+func (s *symmetry) orbit(p point) []point {
+	orbit := make([]point, 0, len(s.transforms))
+	for _, transform := range s.transforms {
+		orbit = append(orbit, transform(p))
+	}
+	return orbit
+}
+
+// p が移り合う位置のうち、値の基準とするもの
+func (s *symmetry) canonical(p point) point {
+	canonical := p
+	for _, q := range s.orbit(p) {
+		if q.less(canonical) {
+			canonical = q
+		}
+	}
+	return canonical
+}
+
+// 格子を対称にする。壁と柱は移り合う位置のうち基準のものに揃え、セルは移
+// り合うどれかに立ち入れれば立ち入れるようにする。
+func (g *grid) symmetrize(s *symmetry) {
+	blocked := newCells(g.cols, g.rows)
+	for y := 0; y < g.rows; y++ {
+		for x := 0; x < g.cols; x++ {
+			blocked[y][x] = true
+			for _, p := range s.orbit(cellPoint(x, y)) {
+				ox, oy := p.cell()
+				blocked[y][x] = blocked[y][x] && g.blocked[oy][ox]
+			}
+		}
+	}
+	g.blocked = blocked
+
+	for _, e := range g.edges() {
+		g.setWall(e, g.hasWall(s.canonical(edgePoint(e)).edge()))
+	}
+
+	for y := 0; y+1 < g.rows; y++ {
+		for x := 0; x+1 < g.cols; x++ {
+			px, py := s.canonical(pillarPoint(x, y)).pillar()
+			g.pillars[y][x] = g.pillars[py][px]
+		}
+	}
+}
+
+// 中央のセル (格子の大きさが偶数なら 2 つか 4 つ) は、どの対称移動でも
+// 自分たちの間で移り合う。
+func (g *grid) carveCenter() (int, int) {
+	g.carveRow((g.rows-1)/2, (g.cols-1)/2, g.cols/2)
+	g.carveRow(g.rows/2, (g.cols-1)/2, g.cols/2)
+	return g.cols / 2, g.rows / 2
+}
+
+// 部屋 r から中央まで通路を掘る。対称にしたときに、移り合う部屋どうしが中
+// 央を通してつながるようにするため。
+func (g *grid) carveToCenter(r room) {
+	x1, y1 := r.center()
+	x2, y2 := g.carveCenter()
+	g.carveRow(y1, x1, x2)
+	g.carveCol(x2, y1, y2)
+}
+
+// 対称移動で互いに移り合う出現セルを Squad の数だけ選ぶ。Squad どうしがで
+// きるだけ離れるセルの中からランダムに選ぶ。
+func (g *grid) chooseSpawns(rng *rand.Rand, s *symmetry, squads int) []cell {
+	if squads == 0 {
+		return []cell{}
+	}
+
+	step := len(s.transforms) / squads
+	imagesOf := func(x, y int) []point {
+		images := make([]point, 0, squads)
+		for idx := 0; idx < squads; idx++ {
+			images = append(images, s.transforms[idx*step](cellPoint(x, y)))
+		}
+		return images
+	}
+
+	var candidates []cell
+	bestDist := -1
+	for y := 0; y < g.rows; y++ {
+		for x := 0; x < g.cols; x++ {
+			if g.blocked[y][x] {
+				continue
+			}
+
+			// 同じセルに移る Squad があれば使えない
+			dist := math.MaxInt32
+			images := imagesOf(x, y)
+			for i := range images {
+				for j := i + 1; j < len(images); j++ {
+					da, db := images[i].a-images[j].a, images[i].b-images[j].b
+					if d := da*da + db*db; d < dist {
+						dist = d
+					}
+				}
+			}
+			if dist == 0 {
+				continue
+			}
+
+			if dist > bestDist {
+				candidates = nil
+				bestDist = dist
+			}
+			if dist == bestDist {
+				candidates = append(candidates, cell{x, y})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return []cell{}
+	}
+
+	base := candidates[rng.Intn(len(candidates))]
+	spawns := make([]cell, 0, squads)
+	for _, p := range imagesOf(base.x, base.y) {
+		x, y := p.cell()
+		spawns = append(spawns, cell{x, y})
+	}
+	return spawns
+}
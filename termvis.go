@@ -181,23 +181,17 @@ func (v *visualizer) drawFieldBorder() {
 
 func (v *visualizer) drawAgents() {
 	snapshot := v.currentSnapshot()
-	fieldWidth, fieldHeight := v.getFieldSize()
-	minX := snapshot.Field.Rect.LT.X
-	minY := snapshot.Field.Rect.LT.Y
+	fieldRect := snapshot.Field.Rect
 	for idx := range snapshot.Agents {
 		agent := &snapshot.Agents[idx]
-		x := int(((agent.Pos.X - minX) / fieldWidth) * float64(v.fieldArea.Width()/2))
-		y := int(((agent.Pos.Y - minY) / fieldHeight) * float64(v.fieldArea.Height()))
+		pos := fieldRect.Clamp(agent.Pos)
+		x := int(((pos.X - fieldRect.LT.X) / fieldRect.Width()) * float64(v.fieldArea.Width()/2))
+		y := int(((pos.Y - fieldRect.LT.Y) / fieldRect.Height()) * float64(v.fieldArea.Height()))
 		// 数学的な座標と考え、画面座標とは Y 座標を反転する
 		y = v.fieldArea.Height() - y
 		x, y = v.fieldArea.Clamp(x, y)
 
-		kind := '?'
-		if agent.Kind == game.Hunter {
-			kind = 'h'
-		} else if agent.Kind == game.Runner {
-			kind = 'r'
-		}
+		kind := snapshot.Config.Kinds.Info(agent.Kind).Symbol
 
 		v.drawAtFieldArea(x, y, []rune(strconv.Itoa(agent.SquadID))[0], kind)
 	}
@@ -229,13 +223,6 @@ func (v *visualizer) drawInfo() {
 	}
 }
 
-func (v *visualizer) getFieldSize() (width, height float64) {
-	fieldRect := v.currentSnapshot().Field.Rect
-	width = fieldRect.RB.X - fieldRect.LT.X
-	height = fieldRect.RB.Y - fieldRect.LT.Y
-	return
-}
-
 type randomAI struct {
 	speed float64
 }
@@ -247,7 +234,7 @@ func (ai *randomAI) Init(config game.GameConfig) error {
 func (ai *randomAI) Think(
 	knowledge game.Knowledge,
 	agent game.Agent,
-) (*game.ActionMove, error) {
+) (game.Action, error) {
 	angle := rand.Float64() * 2 * math.Pi
 	return &game.ActionMove{Dir: geom.NewPolarVector(ai.speed, angle)}, nil
 }
@@ -283,7 +270,11 @@ func createAIPlay() aiplay.AIPlay {
 			},
 		)
 
-	return config.BuildAIPlay()
+	play, err := config.BuildAIPlay()
+	if err != nil {
+		panic(err)
+	}
+	return play
 }
 
 func main() {